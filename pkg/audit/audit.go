@@ -0,0 +1,207 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 审计事件类型。
+const (
+	ActionUpload   = "upload"
+	ActionGenerate = "generate"
+	ActionDownload = "download"
+)
+
+// 审计事件结果。
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// redactedValue 替换敏感变量的值。
+const redactedValue = "******"
+
+// secretNamePattern 匹配通常包含敏感信息的变量名。
+var secretNamePattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|apikey|api_key|credential|private_?key)`)
+
+// Event 描述一条审计记录，以 JSON Lines 的形式追加到日志文件。
+type Event struct {
+	Time     time.Time      `json:"time"`
+	Action   string         `json:"action"`
+	User     string         `json:"user"`
+	ClientIP string         `json:"clientIp"`
+	Template string         `json:"template,omitempty"`
+	Version  string         `json:"version,omitempty"`
+	Values   map[string]any `json:"values,omitempty"`
+	Outcome  string         `json:"outcome"`
+	Error    string         `json:"error,omitempty"`
+	Detail   string         `json:"detail,omitempty"`
+}
+
+// Filter 定义查询条件，零值字段表示不过滤。
+type Filter struct {
+	Template string
+	Action   string
+	User     string
+	Since    time.Time
+	Limit    int // 只返回最近的 Limit 条记录
+}
+
+// Logger 负责追加审计事件，可被多个请求并发调用。
+type Logger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLogger 创建写入 path 的审计日志。
+func NewLogger(path string) *Logger {
+	return &Logger{path: path}
+}
+
+// Path 返回日志文件路径。
+func (l *Logger) Path() string {
+	return l.path
+}
+
+// Record 追加一条事件。未设置时间时使用当前时间。
+func (l *Logger) Record(ev Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("序列化审计事件失败: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("创建审计日志目录失败: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// Query 读取日志并按条件过滤，结果按时间从新到旧排列。
+// 日志文件不存在时返回空结果；无法解析的行会被跳过。
+func Query(path string, filter Filter) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Event{}, nil
+		}
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			continue
+		}
+		if !filter.match(ev) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+
+	// 日志按追加顺序存储，反转为从新到旧
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	if events == nil {
+		events = []Event{}
+	}
+	return events, nil
+}
+
+func (f Filter) match(ev Event) bool {
+	if f.Template != "" && ev.Template != f.Template {
+		return false
+	}
+	if f.Action != "" && ev.Action != f.Action {
+		return false
+	}
+	if f.User != "" && ev.User != f.User {
+		return false
+	}
+	if !f.Since.IsZero() && ev.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// RedactValues 复制 values，并将敏感变量替换为掩码。
+// secret 中列出的字段（来自 manifest 的 secret 标记）以及名称看起来像密码、令牌的字段都会被掩码；
+// 嵌套的 map 和列表会被递归处理，如 db: {password: x} 中的 password 同样会被掩码。
+func RedactValues(values map[string]any, secret map[string]bool) map[string]any {
+	if len(values) == 0 {
+		return nil
+	}
+	return redactMap(values, secret)
+}
+
+// redactMap 复制 m 并掩码其中的敏感字段，secret 只用于顶层变量。
+func redactMap(m map[string]any, secret map[string]bool) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		if v != nil && v != "" && (secret[k] || secretNamePattern.MatchString(k)) {
+			out[k] = redactedValue
+			continue
+		}
+		out[k] = redactNested(v)
+	}
+	return out
+}
+
+// redactNested 递归复制嵌套的 map 和列表，掩码其中名称敏感的字段。
+func redactNested(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return redactMap(v, nil)
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = item
+		}
+		return redactMap(m, nil)
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = redactNested(item)
+		}
+		return out
+	case []map[string]any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = redactMap(item, nil)
+		}
+		return out
+	}
+	return v
+}
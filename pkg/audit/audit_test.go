@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactValues(t *testing.T) {
+	values := map[string]any{
+		"Name":     "demo",
+		"ApiToken": "t0ken",
+		"License":  "MIT",
+		"Empty":    "",
+		"Password": "",
+		"db": map[string]any{
+			"host":     "localhost",
+			"password": "hunter2",
+			"replica": map[string]any{
+				"db_passwd": "nested",
+				"port":      5432,
+			},
+		},
+		"legacy": map[any]any{"secret_key": "s", 1: "one"},
+		"users": []any{
+			map[string]any{"name": "a", "token": "ta"},
+			"plain",
+			[]any{map[string]any{"privateKey": "k"}},
+		},
+		"services": []map[string]any{{"name": "api", "apikey": "k"}},
+	}
+	secret := map[string]bool{"License": true, "Empty": true, "db": false}
+
+	got := RedactValues(values, secret)
+	want := map[string]any{
+		"Name":     "demo",
+		"ApiToken": redactedValue,
+		"License":  redactedValue,
+		"Empty":    "",
+		"Password": "",
+		"db": map[string]any{
+			"host":     "localhost",
+			"password": redactedValue,
+			"replica": map[string]any{
+				"db_passwd": redactedValue,
+				"port":      5432,
+			},
+		},
+		"legacy": map[string]any{"secret_key": redactedValue, "1": "one"},
+		"users": []any{
+			map[string]any{"name": "a", "token": redactedValue},
+			"plain",
+			[]any{map[string]any{"privateKey": redactedValue}},
+		},
+		"services": []any{map[string]any{"name": "api", "apikey": redactedValue}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("掩码结果为 %#v，期望 %#v", got, want)
+	}
+	// 原始变量不被修改
+	if values["db"].(map[string]any)["password"] != "hunter2" || values["users"].([]any)[0].(map[string]any)["token"] != "ta" {
+		t.Fatal("RedactValues 修改了原始变量")
+	}
+}
+
+// TestRedactValuesSecretObject 确认标记为 secret 的对象和列表整体被掩码，secret 标记不作用于嵌套的同名键。
+func TestRedactValuesSecretObject(t *testing.T) {
+	values := map[string]any{
+		"Creds": map[string]any{"user": "u", "pass": "p"},
+		"Keys":  []any{"k1", "k2"},
+		"cfg":   map[string]any{"Creds": "nested"},
+	}
+	got := RedactValues(values, map[string]bool{"Creds": true, "Keys": true})
+	want := map[string]any{
+		"Creds": redactedValue,
+		"Keys":  redactedValue,
+		"cfg":   map[string]any{"Creds": "nested"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("掩码结果为 %#v，期望 %#v", got, want)
+	}
+	if RedactValues(nil, nil) != nil {
+		t.Error("空变量应返回 nil")
+	}
+}
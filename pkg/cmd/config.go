@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jundy/kuai/pkg/config"
+)
+
+func newConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "管理用户级默认值",
+		Long:  "管理 config.yaml 中的个人默认值，kuai use 会在 manifest 默认值之上使用它们，可用 --template 为单个模板覆盖",
+	}
+
+	configCmd.AddCommand(newConfigGetCmd())
+	configCmd.AddCommand(newConfigSetCmd())
+	configCmd.AddCommand(newConfigUnsetCmd())
+	configCmd.AddCommand(newConfigListCmd())
+	return configCmd
+}
+
+func newConfigGetCmd() *cobra.Command {
+	var template string
+
+	cmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "读取默认值",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value, ok := paths.User.Get(template, args[0])
+			if !ok {
+				return fail("未设置 %s", describeKey(template, args[0]))
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), value)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&template, "template", "t", "", "读取指定模板的覆盖值")
+	return cmd
+}
+
+func newConfigSetCmd() *cobra.Command {
+	var template string
+
+	cmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "设置默认值",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths.User.Set(template, args[0], args[1])
+			if err := config.SaveUserConfig(paths.ConfigFile, paths.User); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✅ 已设置 %s = %s\n", describeKey(template, args[0]), args[1])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&template, "template", "t", "", "只对指定模板生效")
+	return cmd
+}
+
+func newConfigUnsetCmd() *cobra.Command {
+	var template string
+
+	cmd := &cobra.Command{
+		Use:   "unset <key>",
+		Short: "删除默认值",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !paths.User.Unset(template, args[0]) {
+				return fail("未设置 %s", describeKey(template, args[0]))
+			}
+			if err := config.SaveUserConfig(paths.ConfigFile, paths.User); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "🗑 已删除 %s\n", describeKey(template, args[0]))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&template, "template", "t", "", "删除指定模板的覆盖值")
+	return cmd
+}
+
+func newConfigListCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "列出所有默认值",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if jsonOutput {
+				data, err := json.MarshalIndent(paths.User, "", "  ")
+				if err != nil {
+					return fmt.Errorf("序列化 JSON 失败: %w", err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+
+			if len(paths.User.Values) == 0 && len(paths.User.Templates) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "暂无默认值，使用 `kuai config set <key> <value>` 设置（%s）。\n", paths.ConfigFile)
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 2, 2, ' ', 0)
+			fmt.Fprintln(w, "SCOPE\tKEY\tVALUE")
+			printScope(w, "global", paths.User.Values)
+			for _, name := range paths.User.TemplateNames() {
+				printScope(w, name, paths.User.Templates[name].Values)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "输出 JSON 格式")
+	return cmd
+}
+
+func printScope(w *tabwriter.Writer, scope string, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", scope, k, values[k])
+	}
+}
+
+func describeKey(template, key string) string {
+	if template == "" {
+		return key
+	}
+	return fmt.Sprintf("%s（模板 %s）", key, template)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -12,7 +13,18 @@ func newDoctorCmd() *cobra.Command {
 		Short: "检查环境配置是否可用",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			fmt.Fprintf(cmd.OutOrStdout(), "配置目录: %s\n", paths.ConfigDir)
+			fmt.Fprintf(cmd.OutOrStdout(), "数据目录: %s\n", paths.DataDir)
+			fmt.Fprintf(cmd.OutOrStdout(), "缓存目录: %s\n", paths.CacheDir)
 			fmt.Fprintf(cmd.OutOrStdout(), "模板目录: %s\n", paths.TemplatesDir)
+			fmt.Fprintf(cmd.OutOrStdout(), "共享 partial 目录: %s\n", paths.PartialsDir)
+			fmt.Fprintln(cmd.OutOrStdout(), "模板搜索路径（按优先级）:")
+			for _, src := range paths.SearchPath {
+				status := ""
+				if _, err := os.Stat(src.Dir); err != nil {
+					status = " (不存在)"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "  - %-7s %s%s\n", src.Name, src.Dir, status)
+			}
 
 			if _, err := templateMgr.List(); err != nil {
 				return fail("读取模板失败: %v", err)
@@ -23,4 +35,3 @@ func newDoctorCmd() *cobra.Command {
 		},
 	}
 }
-
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jundy/kuai/pkg/audit"
+)
+
+func newHistoryCmd() *cobra.Command {
+	var filter audit.Filter
+	var since string
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "查看 Web 服务的生成历史与审计日志",
+		Long:  "查询 kuai web 记录的上传、生成、下载事件，默认显示最近 20 条",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if since != "" {
+				d, err := time.ParseDuration(since)
+				if err != nil {
+					return fail("无法解析 --since %q: %v", since, err)
+				}
+				filter.Since = time.Now().Add(-d)
+			}
+
+			events, err := audit.Query(paths.HistoryFile, filter)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				data, err := json.MarshalIndent(events, "", "  ")
+				if err != nil {
+					return fmt.Errorf("序列化 JSON 失败: %w", err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+
+			if len(events) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "暂无历史记录。")
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 2, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tACTION\tUSER\tCLIENT\tTEMPLATE\tVERSION\tOUTCOME\tDETAIL")
+			for _, ev := range events {
+				detail := ev.Detail
+				if ev.Error != "" {
+					detail = ev.Error
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					ev.Time.Local().Format("2006-01-02 15:04:05"),
+					ev.Action, ev.User, ev.ClientIP, ev.Template, ev.Version, ev.Outcome, detail)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&filter.Template, "template", "", "只显示指定模板的记录")
+	cmd.Flags().StringVar(&filter.Action, "action", "", "只显示指定事件（upload/generate/download）")
+	cmd.Flags().StringVar(&filter.User, "user", "", "只显示指定用户的记录")
+	cmd.Flags().StringVar(&since, "since", "", "只显示最近一段时间内的记录，例如 24h")
+	cmd.Flags().IntVarP(&filter.Limit, "limit", "n", 20, "最多显示条数（0 表示不限制）")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "输出 JSON 格式")
+	return cmd
+}
@@ -2,13 +2,12 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
 
 	"github.com/jundy/kuai/pkg/config"
 	"github.com/jundy/kuai/pkg/templates"
+	"github.com/jundy/kuai/pkg/version"
 )
 
 var (
@@ -21,6 +20,7 @@ var (
 var RootCmd = &cobra.Command{
 	Use:           "kuai",
 	Short:         "Kuai - 快速、稳定的模板管理工具",
+	Version:       version.Version,
 	SilenceErrors: true,
 	SilenceUsage:  true,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
@@ -38,18 +38,16 @@ var RootCmd = &cobra.Command{
 }
 
 func init() {
-	home, _ := os.UserHomeDir()
-	defaultDir := filepath.Join(home, ".kuai")
-
-	RootCmd.PersistentFlags().StringVar(&configDir, "config", defaultDir, "配置目录")
+	RootCmd.PersistentFlags().StringVar(&configDir, "config", "", "配置目录（默认依次使用 KUAI_HOME、XDG 目录）")
 
 	RootCmd.AddCommand(newUseCmd())
 	RootCmd.AddCommand(newTemplateCmd())
 	RootCmd.AddCommand(newDoctorCmd())
 	RootCmd.AddCommand(newWebCmd())
+	RootCmd.AddCommand(newHistoryCmd())
+	RootCmd.AddCommand(newConfigCmd())
 }
 
 func fail(format string, args ...any) error {
 	return fmt.Errorf(format, args...)
 }
-
@@ -15,6 +15,8 @@ func newTemplateCmd() *cobra.Command {
 	templateCmd.AddCommand(newTemplateRemoveCmd())
 	templateCmd.AddCommand(newTemplateExportCmd())
 	templateCmd.AddCommand(newTemplateValidateCmd())
+	templateCmd.AddCommand(newTemplateLintCmd())
+	templateCmd.AddCommand(newTemplateTestCmd())
 	return templateCmd
 }
 
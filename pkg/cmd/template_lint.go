@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jundy/kuai/pkg/templates"
+)
+
+func newTemplateLintCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "lint <name>",
+		Short: "深度检查模板",
+		Long: `解析模板中的每个文件路径和内容，报告语法错误（file:line:col）、未声明或未使用的变量、
+不存在的 partial、可能渲染为 .. 或绝对路径的路径、二进制或不可读的文件，以及 manifest 的结构问题。
+存在错误时以非零状态退出，警告不影响退出状态。
+text/template 的语法错误只报告行号：出错行只有一个 {{ 时列号指向该动作，否则只显示行号。`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			issues, err := templateMgr.Lint(name)
+			if err != nil {
+				return err
+			}
+
+			errorCount, warningCount := 0, 0
+			for _, issue := range issues {
+				if issue.Severity == templates.LintError {
+					errorCount++
+				} else {
+					warningCount++
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if jsonOutput {
+				if issues == nil {
+					issues = []templates.LintIssue{}
+				}
+				data, err := json.MarshalIndent(struct {
+					Template string                `json:"template"`
+					Errors   int                   `json:"errors"`
+					Warnings int                   `json:"warnings"`
+					Issues   []templates.LintIssue `json:"issues"`
+				}{name, errorCount, warningCount, issues}, "", "  ")
+				if err != nil {
+					return fmt.Errorf("序列化 JSON 失败: %w", err)
+				}
+				fmt.Fprintln(out, string(data))
+			} else {
+				for _, issue := range issues {
+					icon := "⚠️ "
+					if issue.Severity == templates.LintError {
+						icon = "❌"
+					}
+					loc := issue.Location()
+					if loc != "" {
+						loc += ": "
+					}
+					fmt.Fprintf(out, "%s %s%s [%s]\n", icon, loc, issue.Message, issue.Rule)
+				}
+				if len(issues) == 0 {
+					fmt.Fprintf(out, "✅ 模板 %s 检查通过\n", name)
+				} else {
+					fmt.Fprintf(out, "\n%d 个错误，%d 个警告\n", errorCount, warningCount)
+				}
+			}
+
+			if errorCount > 0 {
+				return fail("模板 %s 存在 %d 个错误", name, errorCount)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "输出 JSON 格式")
+	return cmd
+}
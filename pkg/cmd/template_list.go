@@ -36,15 +36,28 @@ func newTemplateListCmd() *cobra.Command {
 				return nil
 			}
 			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 2, 2, ' ', 0)
-			fmt.Fprintln(w, "NAME\tDESCRIPTION")
+			fmt.Fprintln(w, "NAME\tSOURCE\tDESCRIPTION")
 			for _, tpl := range templates {
-				fmt.Fprintf(w, "%s\t%s\n", tpl.Name, tpl.Description)
+				fmt.Fprintf(w, "%s\t%s\t%s\n", tpl.Name, tpl.Source, tpl.Description)
 			}
-			return w.Flush()
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			// 说明同名模板的遮蔽关系
+			for _, tpl := range templates {
+				if len(tpl.Shadowed) == 0 {
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "\n⚠️  %s 使用 %s 来源（%s），遮蔽了:\n", tpl.Name, tpl.Source, tpl.Path)
+				for _, sh := range tpl.Shadowed {
+					fmt.Fprintf(cmd.OutOrStdout(), "   - %s: %s\n", sh.Source, sh.Path)
+				}
+			}
+			return nil
 		},
 	}
 
 	cmd.Flags().BoolVar(&jsonOutput, "json", false, "输出 JSON 格式")
 	return cmd
 }
-
@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -25,28 +26,31 @@ func newTemplateShowCmd() *cobra.Command {
 				return err
 			}
 
-			// 加载 manifest
-			manifest, manifestPath, err := templates.LoadManifest(templatePath)
+			// 只需要 manifest 文件的路径；没有 manifest 时 Resolve 会自动扫描生成
+			_, manifestPath, err := templates.LoadManifest(templatePath)
 			if err != nil {
 				return fmt.Errorf("加载模板配置失败: %w", err)
 			}
 
-			// 如果 manifest 不存在，自动扫描生成
-			if manifest == nil {
-				manifest = templates.ScanTemplateVariables(templatePath)
-				manifest.Name = name
+			// 展开 extends/include，显示合并后的字段
+			resolved, err := templateMgr.Resolve(name)
+			if err != nil {
+				return err
 			}
+			manifest := resolved.Manifest
 
 			// 构建输出结构
 			output := struct {
 				Name        string              `json:"name"`
 				Description string              `json:"description"`
 				Path        string              `json:"path"`
+				Chain       []string            `json:"chain"`
 				Manifest    *templates.Manifest `json:"manifest"`
 			}{
 				Name:        name,
 				Description: manifest.Description,
 				Path:        templatePath,
+				Chain:       resolved.Chain,
 				Manifest:    manifest,
 			}
 
@@ -69,6 +73,9 @@ func newTemplateShowCmd() *cobra.Command {
 			} else {
 				fmt.Fprintf(cmd.OutOrStdout(), "配置文件: 自动生成\n")
 			}
+			if len(resolved.Chain) > 1 {
+				fmt.Fprintf(cmd.OutOrStdout(), "合成顺序: %s\n", strings.Join(resolved.Chain, " -> "))
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), "\n变量字段:")
 			if len(manifest.Fields) == 0 {
 				fmt.Fprintln(cmd.OutOrStdout(), "  无")
@@ -85,12 +92,24 @@ func newTemplateShowCmd() *cobra.Command {
 					if field.Description != "" {
 						fmt.Fprintf(cmd.OutOrStdout(), "    说明: %s\n", field.Description)
 					}
+					if field.Type != "" {
+						fmt.Fprintf(cmd.OutOrStdout(), "    类型: %s\n", field.Type)
+					}
 					if field.Default != "" {
 						fmt.Fprintf(cmd.OutOrStdout(), "    默认值: %s\n", field.Default)
 					}
+					if field.Computed() {
+						fmt.Fprintf(cmd.OutOrStdout(), "    计算: %s\n", field.Value)
+					}
 					fmt.Fprintln(cmd.OutOrStdout())
 				}
 			}
+			if len(manifest.Checks) > 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "生成后检查:")
+				for _, check := range manifest.Checks {
+					fmt.Fprintf(cmd.OutOrStdout(), "  - %s\n", check.Label())
+				}
+			}
 
 			return nil
 		},
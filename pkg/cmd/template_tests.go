@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jundy/kuai/pkg/templates"
+)
+
+func newTemplateTestCmd() *cobra.Command {
+	var update bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "test <name> [case...]",
+		Short: "运行模板的测试用例",
+		Long: `渲染模板中 tests/<case>/values.yaml 描述的每个测试用例，并与 tests/<case>/expected/ 中的期望输出比较。
+测试时内置变量使用固定值（Year=2006、Date=2006-01-02、TargetBase=用例名等），保证结果可重复。
+使用 --update 用当前渲染结果重新生成期望输出。`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, cases := args[0], args[1:]
+			if format != "text" && format != "json" && format != "junit" {
+				return fail("不支持的输出格式 %q，可选 text、json、junit", format)
+			}
+
+			resolved, err := templateMgr.Resolve(name)
+			if err != nil {
+				return err
+			}
+			opts := resolved.RenderOptions()
+			opts.PartialDirs = append([]string{paths.PartialsDir}, opts.PartialDirs...)
+			opts.AllowExternalFormatters = true
+
+			results, err := templates.RunTests(resolved, opts, update, cases...)
+			if err != nil {
+				return err
+			}
+			if len(results) == 0 {
+				return fail("模板 %s 没有测试用例（%s/<case>/values.yaml）", name, templates.TestsDir)
+			}
+
+			out := cmd.OutOrStdout()
+			switch format {
+			case "json":
+				data, err := json.MarshalIndent(results, "", "  ")
+				if err != nil {
+					return fmt.Errorf("序列化 JSON 失败: %w", err)
+				}
+				fmt.Fprintln(out, string(data))
+			case "junit":
+				if err := writeJUnit(out, name, results); err != nil {
+					return err
+				}
+			default:
+				printTestResults(out, results)
+			}
+
+			failed := 0
+			for _, r := range results {
+				if !r.Passed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fail("%d/%d 个测试用例失败", failed, len(results))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&update, "update", false, "用渲染结果重新生成期望输出")
+	cmd.Flags().StringVar(&format, "format", "text", "输出格式：text、json 或 junit")
+	return cmd
+}
+
+func printTestResults(w io.Writer, results []templates.TestResult) {
+	for _, r := range results {
+		switch {
+		case r.Updated && r.Passed:
+			fmt.Fprintf(w, "📝 %s 已更新期望输出 (%s)\n", r.Name, r.Duration.Round(time.Millisecond))
+		case r.Passed:
+			fmt.Fprintf(w, "✅ %s (%s)\n", r.Name, r.Duration.Round(time.Millisecond))
+		default:
+			fmt.Fprintf(w, "❌ %s (%s)\n", r.Name, r.Duration.Round(time.Millisecond))
+			if r.Updated {
+				fmt.Fprintln(w, "   已更新期望输出")
+			}
+			if r.Error != "" {
+				fmt.Fprintf(w, "   错误: %s\n", r.Error)
+			}
+			for _, d := range r.Diffs {
+				fmt.Fprintf(w, "   %s %s\n", diffKindLabel(d.Kind), d.Path)
+				for _, line := range strings.Split(d.Diff, "\n") {
+					if line != "" {
+						fmt.Fprintf(w, "      %s\n", line)
+					}
+				}
+			}
+			printCheckResults(w, r.Checks, "   ", true)
+		}
+	}
+}
+
+func diffKindLabel(kind string) string {
+	switch kind {
+	case "missing":
+		return "缺少文件"
+	case "unexpected":
+		return "多余文件"
+	default:
+		return "内容不同"
+	}
+}
+
+// JUnit XML 结构，供 CI 系统展示测试结果。
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, name string, results []templates.TestResult) error {
+	suite := junitSuite{Name: name, Tests: len(results)}
+	for _, r := range results {
+		c := junitCase{Name: r.Name, Classname: name, Time: r.Duration.Seconds()}
+		suite.Time += c.Time
+		if !r.Passed {
+			suite.Failures++
+			var text strings.Builder
+			message := r.Error
+			for _, d := range r.Diffs {
+				fmt.Fprintf(&text, "%s %s\n%s\n", diffKindLabel(d.Kind), d.Path, d.Diff)
+			}
+			failedChecks := 0
+			for _, check := range r.Checks {
+				if !check.Passed {
+					failedChecks++
+					fmt.Fprintf(&text, "检查未通过 %s: %s\n%s\n", check.Name, check.Error, check.Output)
+				}
+			}
+			if message == "" && len(r.Diffs) == 0 && failedChecks > 0 {
+				message = fmt.Sprintf("%d 项检查未通过", failedChecks)
+			}
+			if message == "" {
+				message = fmt.Sprintf("%d 个文件与期望输出不同", len(r.Diffs))
+			}
+			c.Failure = &junitFailure{Message: message, Text: text.String()}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化 JUnit XML 失败: %w", err)
+	}
+	fmt.Fprintln(w, xml.Header+string(data))
+	return nil
+}
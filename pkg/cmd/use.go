@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
@@ -16,6 +21,9 @@ func newUseCmd() *cobra.Command {
 	var valuesFile string
 	var defaults bool
 	var force bool
+	var check bool
+	var allErrors bool
+	var jobs int
 
 	useCmd := &cobra.Command{
 		Use:   "use <template> <target>",
@@ -24,7 +32,7 @@ func newUseCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			name, target := args[0], args[1]
 
-			templatePath, err := templateMgr.TemplatePath(name)
+			resolved, err := templateMgr.Resolve(name)
 			if err != nil {
 				return err
 			}
@@ -33,34 +41,67 @@ func newUseCmd() *cobra.Command {
 				return err
 			}
 
-			manifest, _, err := templates.LoadManifest(templatePath)
+			values, err := templates.CollectValues(templates.ValuesConfig{
+				Manifest:     resolved.Manifest,
+				FromFile:     valuesFile,
+				RawPairs:     vars,
+				UseDefault:   defaults,
+				UserDefaults: paths.User.DefaultsFor(name),
+				Builtins:     templates.Builtins(name, target),
+			})
 			if err != nil {
 				return err
 			}
 
-			values, err := templates.CollectValues(templates.ValuesConfig{
-				Manifest:   manifest,
-				FromFile:   valuesFile,
-				RawPairs:   vars,
-				UseDefault: defaults,
-			})
+			opts := resolved.RenderOptions()
+			opts.PartialDirs = append([]string{paths.PartialsDir}, opts.PartialDirs...)
+			opts.CollectErrors = allErrors
+			opts.Workers = jobs
+			opts.AllowExternalFormatters = true
+
+			// 先渲染到目标旁边的暂存目录，成功后才替换目标目录；失败或中断时目标目录保持原样
+			staging, err := templates.NewStaging(target)
 			if err != nil {
 				return err
 			}
-			values["TemplateName"] = name
+			defer staging.Cleanup()
+			// Ctrl+C 或 SIGTERM 取消渲染，暂存目录随后被删除
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
 
-			// 如果模板目录里有 template/ 子目录，使用它作为源目录（常见模板仓库结构）
-			actualTemplatePath := templatePath
-			templateSubdir := filepath.Join(templatePath, "template")
-			if info, err := os.Stat(templateSubdir); err == nil && info.IsDir() {
-				actualTemplatePath = templateSubdir
+			renderer := &templates.Renderer{Source: templates.DirFS(resolved.SourceDir()), Options: opts}
+			if err := renderer.Render(ctx, values, templates.DirSink{Root: staging.Dir}); err != nil {
+				if ctx.Err() != nil {
+					return fail("操作已中断，%s 未被修改", target)
+				}
+				if renderErrs := templates.AsRenderErrors(err); renderErrs != nil {
+					printRenderErrors(cmd.ErrOrStderr(), renderErrs)
+					return fail("渲染模板 %s 失败，共 %d 个错误，%s 未被修改", name, len(renderErrs), target)
+				}
+				return err
 			}
-
-			if err := templates.Render(actualTemplatePath, target, values); err != nil {
+			if err := staging.Commit(); err != nil {
 				return err
 			}
+			// 之后（如 --check）的中断按默认方式处理
+			stop()
 
 			fmt.Fprintf(cmd.OutOrStdout(), "🚀 已在 %s 基于模板 %s 创建项目。\n", target, name)
+
+			if check {
+				if len(resolved.Manifest.Checks) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "模板没有定义检查")
+					return nil
+				}
+				results, err := templates.RunChecks(resolved.Manifest.Checks, target, values)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "\n检查:")
+				if failed := printCheckResults(cmd.OutOrStdout(), results, "  ", false); failed > 0 {
+					return fail("%d/%d 项检查未通过", failed, len(results))
+				}
+			}
 			return nil
 		},
 	}
@@ -69,51 +110,90 @@ func newUseCmd() *cobra.Command {
 	useCmd.Flags().StringVar(&valuesFile, "values", "", "从 JSON/YAML 文件加载变量")
 	useCmd.Flags().BoolVar(&defaults, "defaults", false, "跳过交互，直接使用默认值")
 	useCmd.Flags().BoolVar(&force, "force", false, "强制覆盖非空目标目录，不询问确认")
+	useCmd.Flags().BoolVar(&check, "check", false, "生成后运行模板中定义的检查（在临时副本中运行，不修改生成结果）")
+	useCmd.Flags().BoolVar(&allErrors, "all-errors", false, "渲染出错时继续处理其他文件，一次报告所有错误")
+	useCmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "并发渲染的文件数，默认为 CPU 核数")
 	return useCmd
 }
 
-func ensureTargetDir(path string, force bool) error {
-	info, err := os.Stat(path)
-	if err == nil {
-		if !info.IsDir() {
-			return fail("目标 %s 已存在且不是目录", path)
+// printRenderErrors 输出渲染错误的位置、目标路径、出错的变量和源文件片段。
+func printRenderErrors(w io.Writer, errs []*templates.RenderError) {
+	for i, e := range errs {
+		if i > 0 {
+			fmt.Fprintln(w)
 		}
-		entries, err := os.ReadDir(path)
-		if err != nil {
-			return err
+		fmt.Fprintf(w, "❌ %s", e.Location())
+		if e.Path != "" && e.Path != e.File {
+			fmt.Fprintf(w, " → %s", e.Path)
 		}
-		if len(entries) > 0 {
-			if force {
-				// 强制模式：直接清空目录
-				if err := os.RemoveAll(path); err != nil {
-					return fmt.Errorf("清空目标目录失败: %w", err)
-				}
-				return os.MkdirAll(path, 0o755)
-			}
-			// 交互式确认
-			prompt := promptui.Prompt{
-				Label:     fmt.Sprintf("目标目录 %s 非空，是否清空并覆盖？(y/N)", path),
-				Default:   "N",
-				AllowEdit: true,
-			}
-			result, err := prompt.Run()
-			if err != nil {
-				return fmt.Errorf("操作已取消")
+		fmt.Fprintln(w)
+		if e.Variable != "" {
+			fmt.Fprintf(w, "   变量 %s: %s\n", e.Variable, e.Message)
+		} else {
+			fmt.Fprintf(w, "   %s\n", e.Message)
+		}
+		for _, line := range strings.Split(strings.TrimRight(e.Snippet, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(w, "   %s\n", line)
 			}
-			if result != "y" && result != "Y" && result != "yes" && result != "Yes" {
-				return fmt.Errorf("操作已取消")
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// printCheckResults 输出检查结果，返回未通过的数量。onlyFailed 为 true 时只输出未通过的检查。
+func printCheckResults(w io.Writer, results []templates.CheckResult, indent string, onlyFailed bool) int {
+	failed := 0
+	for _, r := range results {
+		if r.Passed {
+			if !onlyFailed {
+				fmt.Fprintf(w, "%s✅ %s (%s)\n", indent, r.Name, r.Duration.Round(time.Millisecond))
 			}
-			// 用户确认：清空目录
-			if err := os.RemoveAll(path); err != nil {
-				return fmt.Errorf("清空目标目录失败: %w", err)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "%s❌ %s (%s): %s\n", indent, r.Name, r.Duration.Round(time.Millisecond), r.Error)
+		for _, line := range strings.Split(strings.TrimRight(r.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(w, "%s   %s\n", indent, line)
 			}
-			return os.MkdirAll(path, 0o755)
 		}
-		return nil
 	}
-	if !os.IsNotExist(err) {
+	return failed
+}
+
+// ensureTargetDir 检查目标是否可以使用：不存在或为空目录时直接使用，非空目录需要 --force 或交互确认。
+// 目录不会在这里清空，生成成功后才会替换其中的内容。
+func ensureTargetDir(path string, force bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return err
 	}
-	return os.MkdirAll(path, 0o755)
+	if !info.IsDir() {
+		return fail("目标 %s 已存在且不是目录", path)
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 || force {
+		return nil
+	}
+	// 交互式确认
+	prompt := promptui.Prompt{
+		Label:     fmt.Sprintf("目标目录 %s 非空，是否清空并覆盖？(y/N)", path),
+		Default:   "N",
+		AllowEdit: true,
+	}
+	result, err := prompt.Run()
+	if err != nil {
+		return fmt.Errorf("操作已取消")
+	}
+	if result != "y" && result != "Y" && result != "yes" && result != "Yes" {
+		return fmt.Errorf("操作已取消")
+	}
+	return nil
 }
-
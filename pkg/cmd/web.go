@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -13,37 +22,166 @@ import (
 func newWebCmd() *cobra.Command {
 	var port int
 	var host string
+	var tlsCert, tlsKey string
+	var readTimeout, writeTimeout, idleTimeout, shutdownTimeout time.Duration
+	var maxUploadSize string
+	var trustedProxies []string
+	var basePath string
+	var accessLog string
 
 	webCmd := &cobra.Command{
 		Use:   "web",
 		Short: "启动 Web 界面",
 		Long:  "启动一个 Web 服务器，提供图形化界面来管理模板和生成项目",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			server := web.NewServer(templateMgr, paths)
+			if (tlsCert == "") != (tlsKey == "") {
+				return fail("--tls-cert 和 --tls-key 需要同时设置")
+			}
+			uploadLimit, err := parseSize(maxUploadSize)
+			if err != nil {
+				return fail("无法解析 --max-upload-size %q: %v", maxUploadSize, err)
+			}
+			logWriter, closeLog, err := openAccessLog(accessLog, cmd.OutOrStdout())
+			if err != nil {
+				return err
+			}
+			defer closeLog()
+
+			server, err := web.NewServer(templateMgr, paths, web.Options{
+				BasePath:       basePath,
+				MaxUploadSize:  uploadLimit,
+				TrustedProxies: trustedProxies,
+				AccessLog:      logWriter,
+			})
+			if err != nil {
+				return err
+			}
+
 			addr := fmt.Sprintf("%s:%d", host, port)
+			httpServer := &http.Server{
+				Addr:              addr,
+				Handler:           server,
+				ReadTimeout:       readTimeout,
+				ReadHeaderTimeout: 10 * time.Second,
+				WriteTimeout:      writeTimeout,
+				IdleTimeout:       idleTimeout,
+			}
+
+			prefix := strings.Trim(basePath, "/")
+			if prefix != "" {
+				prefix = "/" + prefix
+			}
+			scheme := "http"
+			if tlsCert != "" {
+				scheme = "https"
+			}
 			fmt.Fprintf(cmd.OutOrStdout(), "🚀 Kuai Web 界面已启动\n")
-			fmt.Fprintf(cmd.OutOrStdout(), "📱 访问地址: http://%s:%d\n", host, port)
-			
+			fmt.Fprintf(cmd.OutOrStdout(), "📱 访问地址: %s://%s:%d%s/\n", scheme, host, port, prefix)
+
 			// 如果监听所有接口，显示本机 IP 地址
 			if host == "0.0.0.0" || host == "" {
 				if ips := getLocalIPs(); len(ips) > 0 {
 					fmt.Fprintf(cmd.OutOrStdout(), "\n💡 可通过以下地址访问:\n")
 					for _, ip := range ips {
-						fmt.Fprintf(cmd.OutOrStdout(), "   http://%s:%d\n", ip, port)
+						fmt.Fprintf(cmd.OutOrStdout(), "   %s://%s:%d%s/\n", scheme, ip, port, prefix)
 					}
 				}
 			}
-			
+
 			fmt.Fprintf(cmd.OutOrStdout(), "\n按 Ctrl+C 停止服务器\n\n")
-			return http.ListenAndServe(addr, server)
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			errCh := make(chan error, 1)
+			go func() {
+				if tlsCert != "" {
+					errCh <- httpServer.ListenAndServeTLS(tlsCert, tlsKey)
+				} else {
+					errCh <- httpServer.ListenAndServe()
+				}
+			}()
+
+			select {
+			case err := <-errCh:
+				if errors.Is(err, http.ErrServerClosed) {
+					return nil
+				}
+				return err
+			case <-ctx.Done():
+			}
+
+			// 收到退出信号：停止接收新请求，等待进行中的生成任务完成
+			fmt.Fprintf(cmd.OutOrStdout(), "\n⏳ 正在关闭服务器，等待进行中的请求完成（最长 %s）...\n", shutdownTimeout)
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				return fmt.Errorf("关闭服务器失败: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "👋 服务器已停止")
+			return nil
 		},
 	}
 
 	webCmd.Flags().IntVarP(&port, "port", "p", 8080, "服务器端口")
 	webCmd.Flags().StringVar(&host, "host", "0.0.0.0", "服务器地址 (0.0.0.0 表示监听所有网络接口)")
+	webCmd.Flags().StringVar(&tlsCert, "tls-cert", "", "TLS 证书文件，与 --tls-key 同时设置时启用 HTTPS")
+	webCmd.Flags().StringVar(&tlsKey, "tls-key", "", "TLS 私钥文件")
+	webCmd.Flags().DurationVar(&readTimeout, "read-timeout", 60*time.Second, "读取整个请求（含上传）的超时时间")
+	webCmd.Flags().DurationVar(&writeTimeout, "write-timeout", 5*time.Minute, "写出响应（含生成和下载）的超时时间")
+	webCmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 2*time.Minute, "keep-alive 空闲连接的超时时间")
+	webCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "收到 SIGTERM 后等待进行中请求完成的最长时间")
+	webCmd.Flags().StringVar(&maxUploadSize, "max-upload-size", "100MB", "上传模板 ZIP 的大小上限（如 512KB、100MB，0 表示不限制）")
+	webCmd.Flags().StringSliceVar(&trustedProxies, "trusted-proxies", nil, "可信反向代理的 IP/CIDR，多个用逗号分隔（默认不信任 X-Forwarded-For 和 X-Forwarded-User 等身份头）")
+	webCmd.Flags().StringVar(&basePath, "base-path", "", "部署在反向代理的路径前缀下时使用，如 /kuai")
+	webCmd.Flags().StringVar(&accessLog, "access-log", "stdout", "JSON 访问日志输出：stdout、stderr、文件路径或 off")
 	return webCmd
 }
 
+// openAccessLog 根据 --access-log 的取值打开日志输出。
+func openAccessLog(target string, stdout io.Writer) (io.Writer, func(), error) {
+	switch target {
+	case "", "off", "none":
+		return nil, func() {}, nil
+	case "stdout":
+		return stdout, func() {}, nil
+	case "stderr":
+		return os.Stderr, func() {}, nil
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开访问日志失败: %w", err)
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// parseSize 解析带单位的大小，如 512KB、100MB、1GB，纯数字按字节处理。
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"GB", 1 << 30}, {"G", 1 << 30},
+		{"MB", 1 << 20}, {"M", 1 << 20},
+		{"KB", 1 << 10}, {"K", 1 << 10},
+		{"B", 1},
+	}
+	factor := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("需要非负整数加可选单位（B/KB/MB/GB）")
+	}
+	return n * factor, nil
+}
+
 // getLocalIPs 获取本机的非回环 IP 地址列表
 func getLocalIPs() []string {
 	var ips []string
@@ -51,7 +189,7 @@ func getLocalIPs() []string {
 	if err != nil {
 		return ips
 	}
-	
+
 	for _, addr := range addrs {
 		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
 			if ipNet.IP.To4() != nil {
@@ -61,4 +199,3 @@ func getLocalIPs() []string {
 	}
 	return ips
 }
-
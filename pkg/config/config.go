@@ -1,42 +1,278 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// 环境变量。
+const (
+	EnvHome         = "KUAI_HOME"          // 使用单一目录存放所有数据（旧版 ~/.kuai 布局）
+	EnvTemplatesDir = "KUAI_TEMPLATES_DIR" // 覆盖用户模板目录
+)
+
+// migratedMarker 写入旧目录，表示已迁移到 XDG 目录。
+const migratedMarker = "MIGRATED.txt"
+
 // Paths 包含所有需要的目录。
 type Paths struct {
-	ConfigDir    string
-	TemplatesDir string
+	ConfigDir    string      // 配置文件所在目录
+	DataDir      string      // 模板、备份、审计日志等数据所在目录
+	CacheDir     string      // 可随时删除的缓存目录
+	TemplatesDir string      // 用户模板目录
+	PartialsDir  string      // 所有模板共享的 partial 目录
+	HistoryFile  string      // Web 服务的审计日志（JSON Lines）
+	ConfigFile   string      // 用户级配置文件 config.yaml
+	User         *UserConfig // 从 ConfigFile 加载的用户配置，文件不存在时为空配置
+	// SearchPath 是按优先级排列的模板搜索路径，靠前的目录会遮蔽后面的同名模板。
+	// TemplatesDir 作为 user 来源包含在其中，也是 add/remove 操作的目录。
+	SearchPath []TemplateSource
+	// LegacyDir 是使用 XDG 布局时需要迁移的旧版 ~/.kuai 目录，为空表示无需迁移。
+	LegacyDir string
 }
 
-// Resolve 根据用户输入计算目录路径。
+// Resolve 根据用户输入计算目录路径，并加载用户级配置文件。
+// 优先级：--config 参数 > KUAI_HOME > XDG 目录（$XDG_CONFIG_HOME/kuai、$XDG_DATA_HOME/kuai、$XDG_CACHE_HOME/kuai）。
+// 前两种情况下所有数据都存放在同一目录中；Windows 上未设置 XDG 变量时仍使用 ~/.kuai。
+// KUAI_TEMPLATES_DIR 可单独覆盖用户模板目录。
 func Resolve(custom string) (Paths, error) {
 	dir := custom
 	if dir == "" {
+		dir = os.Getenv(EnvHome)
+	}
+
+	var p Paths
+	if dir != "" {
+		p = singleDirPaths(dir)
+	} else {
 		home, err := os.UserHomeDir()
 		if err != nil {
 			return Paths{}, fmt.Errorf("无法获取用户目录: %w", err)
 		}
-		dir = filepath.Join(home, ".kuai")
+		legacy := filepath.Join(home, ".kuai")
+		if useXDG() {
+			p = xdgPaths(home)
+			p.LegacyDir = legacy
+		} else {
+			p = singleDirPaths(legacy)
+		}
 	}
 
+	if dir := os.Getenv(EnvTemplatesDir); dir != "" {
+		p.TemplatesDir = dir
+	}
+	p.SearchPath = buildSearchPath(p.TemplatesDir)
+	user, err := LoadUserConfig(p.ConfigFile)
+	if err != nil {
+		return Paths{}, err
+	}
+	p.User = user
+	return p, nil
+}
+
+// singleDirPaths 返回所有数据都存放在 dir 下的布局。
+func singleDirPaths(dir string) Paths {
 	return Paths{
 		ConfigDir:    dir,
+		DataDir:      dir,
+		CacheDir:     filepath.Join(dir, "cache"),
 		TemplatesDir: filepath.Join(dir, "templates"),
-	}, nil
+		PartialsDir:  filepath.Join(dir, "partials"),
+		HistoryFile:  filepath.Join(dir, "history.jsonl"),
+		ConfigFile:   filepath.Join(dir, "config.yaml"),
+	}
+}
+
+// xdgPaths 返回遵循 XDG Base Directory 规范的布局。
+func xdgPaths(home string) Paths {
+	configDir := filepath.Join(xdgDir("XDG_CONFIG_HOME", filepath.Join(home, ".config")), "kuai")
+	dataDir := filepath.Join(xdgDir("XDG_DATA_HOME", filepath.Join(home, ".local", "share")), "kuai")
+	cacheDir := filepath.Join(xdgDir("XDG_CACHE_HOME", filepath.Join(home, ".cache")), "kuai")
+	return Paths{
+		ConfigDir:    configDir,
+		DataDir:      dataDir,
+		CacheDir:     cacheDir,
+		TemplatesDir: filepath.Join(dataDir, "templates"),
+		PartialsDir:  filepath.Join(configDir, "partials"),
+		HistoryFile:  filepath.Join(dataDir, "history.jsonl"),
+		ConfigFile:   filepath.Join(configDir, "config.yaml"),
+	}
 }
 
-// Ensure 确保核心目录存在。
+// xdgDir 读取 XDG 环境变量；规范要求忽略相对路径。
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return fallback
+}
+
+// useXDG 判断是否使用 XDG 布局：Windows 上仅在显式设置了 XDG 变量时使用。
+func useXDG() bool {
+	if runtime.GOOS != "windows" {
+		return true
+	}
+	for _, env := range []string{"XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Ensure 确保核心目录存在，并在首次使用 XDG 布局时从 ~/.kuai 迁移数据。
 func Ensure(p Paths) error {
+	if err := migrateLegacy(p); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(p.ConfigDir, 0o755); err != nil {
 		return fmt.Errorf("创建配置目录失败: %w", err)
 	}
+	if p.DataDir != "" {
+		if err := os.MkdirAll(p.DataDir, 0o755); err != nil {
+			return fmt.Errorf("创建数据目录失败: %w", err)
+		}
+	}
 	if err := os.MkdirAll(p.TemplatesDir, 0o755); err != nil {
 		return fmt.Errorf("创建模板目录失败: %w", err)
 	}
 	return nil
 }
 
+// migrateLegacy 将旧版 ~/.kuai 中的模板、配置、备份和审计日志移动到 XDG 目录。
+// 迁移只执行一次：完成后在旧目录写入标记文件；目标位置已有内容的条目不会被覆盖。
+func migrateLegacy(p Paths) error {
+	if p.LegacyDir == "" {
+		return nil
+	}
+	if info, err := os.Stat(p.LegacyDir); err != nil || !info.IsDir() {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(p.LegacyDir, migratedMarker)); err == nil {
+		return nil
+	}
+
+	moves := []struct{ from, to string }{
+		{filepath.Join(p.LegacyDir, "templates"), p.TemplatesDir},
+		{filepath.Join(p.LegacyDir, "backups"), filepath.Join(p.DataDir, "backups")},
+		{filepath.Join(p.LegacyDir, "history.jsonl"), p.HistoryFile},
+		{filepath.Join(p.LegacyDir, "config.yaml"), p.ConfigFile},
+	}
+	var moved []string
+	for _, mv := range moves {
+		if _, err := os.Stat(mv.from); err != nil {
+			continue
+		}
+		if !isEmptyOrMissing(mv.to) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(mv.to), 0o755); err != nil {
+			return fmt.Errorf("迁移 %s 失败: %w", mv.from, err)
+		}
+		// 空目录可能由之前的运行创建，先删除以便整体移动
+		os.Remove(mv.to)
+		if err := moveTree(mv.from, mv.to); err != nil {
+			return fmt.Errorf("迁移 %s 到 %s 失败: %w", mv.from, mv.to, err)
+		}
+		moved = append(moved, fmt.Sprintf("%s -> %s", mv.from, mv.to))
+	}
+
+	// 配置文件在 Resolve 时按新路径加载，迁移后需要重新读取
+	if p.User != nil {
+		if user, err := LoadUserConfig(p.ConfigFile); err == nil {
+			*p.User = *user
+		}
+	}
+
+	note := fmt.Sprintf("kuai 已于 %s 将数据迁移到 XDG 目录，此目录不再使用，可以删除。\n\n%s\n",
+		time.Now().Format(time.RFC3339), strings.Join(moved, "\n"))
+	if err := os.WriteFile(filepath.Join(p.LegacyDir, migratedMarker), []byte(note), 0o644); err != nil {
+		return fmt.Errorf("写入迁移标记失败: %w", err)
+	}
+	return nil
+}
+
+// moveTree 将文件或目录 from 移动到 to。两者位于不同文件系统（如 ~/.kuai 与 XDG 目录分属不同挂载点）时
+// 无法重命名，改为复制后删除原位置；复制失败时删除已复制的部分，原位置保持不变。
+func moveTree(from, to string) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyTree(from, to); err != nil {
+		os.RemoveAll(to)
+		return err
+	}
+	// 数据已经完整复制到新位置，原位置删除失败不影响迁移结果
+	os.RemoveAll(from)
+	return nil
+}
+
+// copyTree 递归复制 from 到 to，保留权限和符号链接。
+func copyTree(from, to string) error {
+	return filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(from, to string, mode fs.FileMode) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// isEmptyOrMissing 判断路径不存在或是空目录。
+func isEmptyOrMissing(path string) bool {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) == 0
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// writeFiles 在 dir 中创建 files 描述的文件（相对路径 -> 内容）。
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFiles 返回 dir 中所有普通文件的相对路径（使用 / 分隔）和内容，dir 不存在时返回 nil。
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// legacyFiles 是旧版 ~/.kuai 目录中的数据。
+var legacyFiles = map[string]string{
+	"templates/demo/kuai.yaml":   "name: demo\n",
+	"templates/demo/main.go":     "package main\n",
+	"backups/demo-1/kuai.yaml":   "name: demo\n",
+	"history.jsonl":              `{"action":"generate"}` + "\n",
+	"config.yaml":                "values:\n  Author: legacy\n",
+	"cache/ignored-by-migration": "x",
+}
+
+// setupXDG 设置 HOME 和 XDG 变量指向临时目录，返回 Resolve 得到的 XDG 布局。
+func setupXDG(t *testing.T) (home string, p Paths) {
+	t.Helper()
+	home = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg-config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "xdg-data"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "xdg-cache"))
+	t.Setenv(EnvHome, "")
+	t.Setenv(EnvTemplatesDir, "")
+	t.Setenv("KUAI_PATH", "")
+	writeFiles(t, filepath.Join(home, ".kuai"), legacyFiles)
+	p, err := Resolve("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.LegacyDir != filepath.Join(home, ".kuai") {
+		t.Fatalf("LegacyDir 为 %q，期望 ~/.kuai", p.LegacyDir)
+	}
+	return home, p
+}
+
+func TestEnsureMigratesLegacy(t *testing.T) {
+	home, p := setupXDG(t)
+	legacy := p.LegacyDir
+	if err := Ensure(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := readFiles(t, p.TemplatesDir), map[string]string{
+		"demo/kuai.yaml": "name: demo\n",
+		"demo/main.go":   "package main\n",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("模板目录为 %q，期望 %q", got, want)
+	}
+	if got := readFiles(t, filepath.Join(p.DataDir, "backups")); got["demo-1/kuai.yaml"] != "name: demo\n" {
+		t.Errorf("备份目录为 %q", got)
+	}
+	if data, err := os.ReadFile(p.HistoryFile); err != nil || string(data) != legacyFiles["history.jsonl"] {
+		t.Errorf("审计日志为 %q（%v）", data, err)
+	}
+	if p.User.Values["Author"] != "legacy" {
+		t.Errorf("迁移后没有重新加载用户配置: %+v", p.User)
+	}
+
+	// 旧目录中只剩未迁移的条目和迁移标记
+	got := readFiles(t, legacy)
+	if _, ok := got[migratedMarker]; !ok {
+		t.Fatal("没有写入迁移标记")
+	}
+	delete(got, migratedMarker)
+	if want := map[string]string{"cache/ignored-by-migration": "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("旧目录中剩余 %q，期望 %q", got, want)
+	}
+	if filepath.Dir(p.ConfigDir) != filepath.Join(home, "xdg-config") {
+		t.Errorf("ConfigDir 为 %q，期望位于 XDG_CONFIG_HOME", p.ConfigDir)
+	}
+}
+
+func TestEnsureMigrationIdempotent(t *testing.T) {
+	_, p := setupXDG(t)
+	if err := Ensure(p); err != nil {
+		t.Fatal(err)
+	}
+	marker, err := os.ReadFile(filepath.Join(p.LegacyDir, migratedMarker))
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated := readFiles(t, p.TemplatesDir)
+
+	// 迁移完成后旧目录中新出现的数据不会再被迁移，已迁移的数据保持不变
+	writeFiles(t, p.LegacyDir, map[string]string{"templates/late/kuai.yaml": "name: late\n"})
+	for i := 0; i < 2; i++ {
+		if err := Ensure(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFiles(t, p.TemplatesDir); !reflect.DeepEqual(got, migrated) {
+		t.Errorf("再次运行后模板目录为 %q，期望保持 %q", got, migrated)
+	}
+	if _, err := os.Stat(filepath.Join(p.LegacyDir, "templates", "late", "kuai.yaml")); err != nil {
+		t.Errorf("迁移完成后旧目录中的新数据被移动: %v", err)
+	}
+	if again, _ := os.ReadFile(filepath.Join(p.LegacyDir, migratedMarker)); string(again) != string(marker) {
+		t.Error("迁移标记被重写")
+	}
+}
+
+func TestEnsureMigrationKeepsExisting(t *testing.T) {
+	_, p := setupXDG(t)
+	// 已有内容的模板目录不会被覆盖，空的数据目录（如之前的运行创建的）会被替换
+	writeFiles(t, p.TemplatesDir, map[string]string{"mine/kuai.yaml": "name: mine\n"})
+	if err := os.MkdirAll(filepath.Join(p.DataDir, "backups"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Ensure(p); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFiles(t, p.TemplatesDir), map[string]string{"mine/kuai.yaml": "name: mine\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("模板目录为 %q，期望保持 %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(p.LegacyDir, "templates", "demo", "kuai.yaml")); err != nil {
+		t.Errorf("未迁移的模板应留在旧目录: %v", err)
+	}
+	if got := readFiles(t, filepath.Join(p.DataDir, "backups")); got["demo-1/kuai.yaml"] != "name: demo\n" {
+		t.Errorf("备份目录为 %q，期望迁移到空目录中", got)
+	}
+}
+
+// TestResolveKuaiHome 确认设置 KUAI_HOME 时使用单一目录布局，不迁移 ~/.kuai。
+func TestResolveKuaiHome(t *testing.T) {
+	home, _ := setupXDG(t)
+	dir := filepath.Join(home, "kuai-home")
+	t.Setenv(EnvHome, dir)
+	p, err := Resolve("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.LegacyDir != "" || p.TemplatesDir != filepath.Join(dir, "templates") || p.ConfigFile != filepath.Join(dir, "config.yaml") {
+		t.Fatalf("路径为 %+v，期望全部位于 %s", p, dir)
+	}
+	if err := Ensure(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFiles(t, p.TemplatesDir); len(got) != 0 {
+		t.Errorf("KUAI_HOME 的模板目录为 %q，期望为空", got)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".kuai", migratedMarker)); err == nil {
+		t.Error("使用 KUAI_HOME 时不应迁移 ~/.kuai")
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	from := t.TempDir()
+	writeFiles(t, from, map[string]string{"a.txt": "a", "sub/b.sh": "b"})
+	if err := os.Chmod(filepath.Join(from, "sub", "b.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(from, "link")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	to := filepath.Join(t.TempDir(), "copy")
+	if err := copyTree(from, to); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFiles(t, to), map[string]string{"a.txt": "a", "sub/b.sh": "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("复制结果为 %q，期望 %q", got, want)
+	}
+	if link, err := os.Readlink(filepath.Join(to, "link")); err != nil || link != "a.txt" {
+		t.Errorf("符号链接为 %q（%v），期望 a.txt", link, err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(to, "sub", "b.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o755 {
+			t.Errorf("b.sh 的权限为 %v，期望 0755", info.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// 模板来源名称，按默认优先级从高到低排列。
+const (
+	SourceProject = "project" // 从当前目录向上查找到的 .kuai/templates
+	SourceEnv     = "env"     // KUAI_PATH 环境变量中的目录
+	SourceUser    = "user"    // 用户模板目录
+	SourceSystem  = "system"  // 系统级共享目录
+)
+
+// ProjectTemplatesDir 是项目内模板目录相对于项目根目录的路径。
+var ProjectTemplatesDir = filepath.Join(".kuai", "templates")
+
+// TemplateSource 是模板搜索路径中的一个目录。
+type TemplateSource struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+// buildSearchPath 按优先级生成模板搜索路径：项目目录、KUAI_PATH、用户目录、系统目录。
+// 重复的目录只保留优先级最高的一项；不存在的目录也会保留，由调用方在读取时跳过。
+func buildSearchPath(userDir string) []TemplateSource {
+	var sources []TemplateSource
+	if dir := findProjectTemplatesDir(userDir); dir != "" {
+		sources = append(sources, TemplateSource{Name: SourceProject, Dir: dir})
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("KUAI_PATH")) {
+		if dir != "" {
+			sources = append(sources, TemplateSource{Name: SourceEnv, Dir: dir})
+		}
+	}
+	sources = append(sources, TemplateSource{Name: SourceUser, Dir: userDir})
+	if dir := systemTemplatesDir(); dir != "" {
+		sources = append(sources, TemplateSource{Name: SourceSystem, Dir: dir})
+	}
+
+	seen := map[string]bool{}
+	result := make([]TemplateSource, 0, len(sources))
+	for _, src := range sources {
+		key := src.Dir
+		if abs, err := filepath.Abs(src.Dir); err == nil {
+			key = abs
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, src)
+	}
+	return result
+}
+
+// findProjectTemplatesDir 从当前目录向上查找 .kuai/templates，找不到时返回空字符串。
+// 用户目录本身和旧版 ~/.kuai/templates 不会被当作项目目录。
+func findProjectTemplatesDir(userDir string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	excluded := map[string]bool{}
+	if abs, err := filepath.Abs(userDir); err == nil {
+		excluded[abs] = true
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		excluded[filepath.Join(home, ProjectTemplatesDir)] = true
+	}
+	for {
+		candidate := filepath.Join(dir, ProjectTemplatesDir)
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() && !excluded[candidate] {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// systemTemplatesDir 返回系统级共享模板目录。
+func systemTemplatesDir() string {
+	if runtime.GOOS == "windows" {
+		if programData := os.Getenv("ProgramData"); programData != "" {
+			return filepath.Join(programData, "kuai", "templates")
+		}
+		return ""
+	}
+	return "/usr/local/share/kuai/templates"
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UserConfig 是用户级配置文件的内容，保存个人常用的变量默认值。
+//
+//	values:
+//	  RepoBase: github.com
+//	  AuthorName: Jundy
+//	templates:
+//	  go-service:
+//	    values:
+//	      Port: "9000"
+type UserConfig struct {
+	Values    map[string]string         `yaml:"values,omitempty"`    // 所有模板共用的默认值
+	Templates map[string]TemplateConfig `yaml:"templates,omitempty"` // 按模板名覆盖的默认值
+}
+
+// TemplateConfig 保存单个模板的用户配置。
+type TemplateConfig struct {
+	Values map[string]string `yaml:"values,omitempty"`
+}
+
+// LoadUserConfig 读取用户配置文件，文件不存在时返回空配置。
+func LoadUserConfig(path string) (*UserConfig, error) {
+	cfg := &UserConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("读取用户配置失败: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("解析用户配置 %s 失败: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// SaveUserConfig 将用户配置写回文件。
+func SaveUserConfig(path string, cfg *UserConfig) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("序列化用户配置失败: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建配置目录失败: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// DefaultsFor 返回指定模板生效的默认值：模板级配置覆盖全局配置。
+func (c *UserConfig) DefaultsFor(template string) map[string]string {
+	out := map[string]string{}
+	if c == nil {
+		return out
+	}
+	for k, v := range c.Values {
+		out[k] = v
+	}
+	for k, v := range c.Templates[template].Values {
+		out[k] = v
+	}
+	return out
+}
+
+// Get 读取一个默认值，template 为空表示全局配置。
+func (c *UserConfig) Get(template, key string) (string, bool) {
+	v, ok := c.scope(template)[key]
+	return v, ok
+}
+
+// Set 设置一个默认值，template 为空表示全局配置。
+func (c *UserConfig) Set(template, key, value string) {
+	if template == "" {
+		if c.Values == nil {
+			c.Values = map[string]string{}
+		}
+		c.Values[key] = value
+		return
+	}
+	if c.Templates == nil {
+		c.Templates = map[string]TemplateConfig{}
+	}
+	tc := c.Templates[template]
+	if tc.Values == nil {
+		tc.Values = map[string]string{}
+	}
+	tc.Values[key] = value
+	c.Templates[template] = tc
+}
+
+// Unset 删除一个默认值，返回该键是否存在。
+func (c *UserConfig) Unset(template, key string) bool {
+	values := c.scope(template)
+	if _, ok := values[key]; !ok {
+		return false
+	}
+	delete(values, key)
+	if template != "" && len(values) == 0 {
+		delete(c.Templates, template)
+	}
+	return true
+}
+
+// TemplateNames 返回配置了覆盖值的模板名（已排序）。
+func (c *UserConfig) TemplateNames() []string {
+	names := make([]string, 0, len(c.Templates))
+	for name := range c.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *UserConfig) scope(template string) map[string]string {
+	if template == "" {
+		return c.Values
+	}
+	return c.Templates[template].Values
+}
@@ -0,0 +1,180 @@
+package templates
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinkTarget 是 ZIP 中符号链接目标的最大长度。
+const maxLinkTarget = 4096
+
+// ZipDir 将目录打包为 ZIP 文件（跳过 .git）。
+// 文件和目录的权限会写入 ZIP；符号链接按 ZIP 的约定保存为链接，内容是链接目标，不会跟随。
+func ZipDir(dir, zipPath string) error {
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("创建 ZIP 文件失败: %w", err)
+	}
+	defer zipFile.Close()
+
+	zw := zip.NewWriter(zipFile)
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+
+		switch {
+		case entry.IsDir():
+			header.Name += "/"
+			_, err = zw.CreateHeader(header)
+			return err
+		case entry.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, filepath.ToSlash(target))
+			return err
+		default:
+			header.Method = zip.Deflate
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(w, file)
+			return err
+		}
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// ExtractZip 将 ZIP 文件解压到 destDir，保留文件权限并重建符号链接。
+// 路径逃逸出 destDir 的条目（zip-slip）、指向 destDir 之外的符号链接以及经过符号链接的条目会被拒绝。
+func ExtractZip(zipPath, destDir string) error {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		rel := filepath.Clean(filepath.FromSlash(strings.TrimSuffix(f.Name, "/")))
+		if filepath.IsAbs(rel) || strings.HasPrefix(f.Name, "/") || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("ZIP 条目 %s 指向目录之外，拒绝解压", f.Name)
+		}
+		if err := checkNoSymlink(destDir, rel); err != nil {
+			return fmt.Errorf("ZIP 条目 %s: %w", f.Name, err)
+		}
+		target := filepath.Join(destDir, rel)
+		mode := f.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()|0o700); err != nil {
+				return err
+			}
+		case mode&fs.ModeSymlink != 0:
+			link, err := readZipEntry(f, maxLinkTarget)
+			if err != nil {
+				return err
+			}
+			linkTarget := filepath.FromSlash(string(link))
+			if err := checkLinkTarget(rel, linkTarget); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(linkTarget, target); err != nil {
+				return err
+			}
+		default:
+			if err := extractZipFile(f, target, mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func extractZipFile(f *zip.File, target string, perm fs.FileMode) error {
+	if perm == 0 {
+		// 非 Unix 系统创建的 ZIP 可能不包含权限
+		perm = 0o644
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(target, perm)
+}
+
+// readZipEntry 读取 ZIP 条目的内容，超过 limit 字节时返回错误。
+func readZipEntry(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("ZIP 条目 %s 过大", f.Name)
+	}
+	return data, nil
+}
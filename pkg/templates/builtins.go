@@ -0,0 +1,64 @@
+package templates
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jundy/kuai/pkg/version"
+)
+
+// BuiltinNames 是 kuai 自动提供的内置变量，可以通过 --var 等方式覆盖。
+var BuiltinNames = []string{
+	"TemplateName", // 模板名
+	"Year",         // 当前年份，如 2024
+	"Date",         // 当前日期，如 2024-01-31
+	"TargetDir",    // 目标目录（绝对路径；Web 生成时为项目名）
+	"TargetBase",   // 目标目录的最后一级名称
+	"GitUserName",  // git config user.name（Web 生成时为空）
+	"GitUserEmail", // git config user.email（Web 生成时为空）
+	"GOOS",         // 运行 kuai 的操作系统
+	"KuaiVersion",  // kuai 版本号
+}
+
+// IsBuiltin 判断变量名是否为内置变量。
+func IsBuiltin(name string) bool {
+	for _, n := range BuiltinNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Builtins 计算一次所有内置变量。
+// target 为生成项目的目标目录，相对路径会转换为绝对路径。
+func Builtins(templateName, target string) map[string]string {
+	now := time.Now()
+	targetDir := target
+	if abs, err := filepath.Abs(target); err == nil && target != "" {
+		targetDir = abs
+	}
+	return map[string]string{
+		"TemplateName": templateName,
+		"Year":         now.Format("2006"),
+		"Date":         now.Format("2006-01-02"),
+		"TargetDir":    targetDir,
+		"TargetBase":   filepath.Base(targetDir),
+		"GitUserName":  gitConfig("user.name"),
+		"GitUserEmail": gitConfig("user.email"),
+		"GOOS":         runtime.GOOS,
+		"KuaiVersion":  version.Version,
+	}
+}
+
+// gitConfig 读取 git 配置，git 不可用或未设置时返回空字符串。
+func gitConfig(key string) string {
+	out, err := exec.Command("git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
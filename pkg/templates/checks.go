@@ -0,0 +1,323 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// DefaultCheckTimeout 是未设置 timeout 的检查的超时时间。
+const DefaultCheckTimeout = 2 * time.Minute
+
+// maxCheckOutput 是检查结果中保留的命令输出长度（取末尾部分）。
+const maxCheckOutput = 4096
+
+// Check 是渲染完成后对生成结果的检查，run 和 exists 二选一。
+// run 和 exists 都可以使用模板语法引用变量，例如 exists: "cmd/{{Name}}/main.go"。
+type Check struct {
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`       // 显示名称，为空时使用 run 或 exists
+	Run     string `json:"run,omitempty" yaml:"run,omitempty"`         // 在生成目录中执行的 shell 命令，如 go build ./...
+	Exists  string `json:"exists,omitempty" yaml:"exists,omitempty"`   // 必须存在的文件或目录（相对生成目录）
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"` // 超时时间，如 30s、5m，默认 2m
+}
+
+// Label 返回检查的显示名称。
+func (c Check) Label() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.Run != "":
+		return c.Run
+	default:
+		return "exists " + c.Exists
+	}
+}
+
+// validate 检查 run/exists 是否二选一以及 timeout 是否有效，返回超时时间。
+func (c Check) validate() (time.Duration, error) {
+	if (c.Run == "") == (c.Exists == "") {
+		return 0, fmt.Errorf("检查 %q 需要且只能设置 run 或 exists 之一", c.Label())
+	}
+	if c.Timeout == "" {
+		return DefaultCheckTimeout, nil
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("检查 %q 的 timeout %q 无效", c.Label(), c.Timeout)
+	}
+	return timeout, nil
+}
+
+// CheckResult 是单项检查的结果。
+type CheckResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output,omitempty"` // 命令的输出（过长时只保留末尾）
+	Error    string        `json:"error,omitempty"`
+}
+
+// RunChecks 对 dir 中的生成结果依次执行检查。
+// 检查在 dir 的临时副本中运行，命令不会修改生成结果；命令使用精简的环境变量、不读取标准输入，超时后会被终止。
+// 这些措施只用于避免误操作，并不是安全沙箱：命令以当前用户的身份运行，可以读写临时副本之外的文件、访问网络，
+// 只应对可信的模板运行检查。
+func RunChecks(checks []Check, dir string, values map[string]any) ([]CheckResult, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+	sandbox, err := os.MkdirTemp("", "kuai-check-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(sandbox)
+	if err := copyDir(dir, sandbox); err != nil {
+		return nil, fmt.Errorf("准备检查目录失败: %w", err)
+	}
+
+	results := make([]CheckResult, 0, len(checks))
+	for _, check := range checks {
+		start := time.Now()
+		result := runCheck(check, sandbox, values)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func runCheck(check Check, dir string, values map[string]any) CheckResult {
+	result := CheckResult{Name: check.Label()}
+	timeout, err := check.validate()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if check.Exists != "" {
+		rel, err := renderCheckText(check.Exists, values)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if err := checkTargetPath(filepath.Clean(filepath.FromSlash(rel))); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			result.Error = fmt.Sprintf("%s 不存在", rel)
+			return result
+		}
+		result.Passed = true
+		return result
+	}
+
+	command, err := renderCheckCommand(check.Run, values)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = dir
+	cmd.Env = checkEnv(os.Environ())
+	isolateProcess(cmd)
+	// 命令被终止后，不再等待仍持有输出管道的子进程
+	cmd.WaitDelay = time.Second
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err = cmd.Run()
+	result.Output = tail(output.String(), maxCheckOutput)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.Error = fmt.Sprintf("超时（%s）", timeout)
+	case err != nil:
+		result.Error = err.Error()
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// renderCheckText 使用变量渲染检查中的路径。
+func renderCheckText(text string, values map[string]any) (string, error) {
+	tmpl, err := template.New("check").Funcs(buildFuncMap(values)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析检查 %q 失败: %w", text, err)
+	}
+	return executeCheck(tmpl, text, values)
+}
+
+// renderCheckCommand 使用变量渲染检查中的命令。每个输出值的动作（如 {{Name}}）都会经过 shquote，
+// 变量的值总是作为一个完整的参数传给 shell，不会被解释为其他命令。
+func renderCheckCommand(text string, values map[string]any) (string, error) {
+	funcs := buildFuncMap(values)
+	funcs["shquote"] = shellQuote
+	tmpl, err := template.New("check").Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析检查 %q 失败: %w", text, err)
+	}
+	if _, err := quoteActions(tmpl.Tree, tmpl.Tree.Root, 0); err != nil {
+		return "", fmt.Errorf("解析检查 %q 失败: %w", text, err)
+	}
+	return executeCheck(tmpl, text, values)
+}
+
+// checkCommandQuotes 检查命令中输出值的动作是否都位于引号之外，不需要变量的值。
+func checkCommandQuotes(text string) error {
+	tree := parse.New("check")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", map[string]*parse.Tree{}); err != nil {
+		return err
+	}
+	_, err := quoteActions(tree, tree.Root, 0)
+	return err
+}
+
+// quoteActions 在 node 中每个输出值的动作的管道末尾追加 shquote，返回 node 之后命令文本所处的引号（见 scanQuotes）。
+// 动作位于引号内或紧跟在 \ 之后时，加上的引号会失效（双引号内的 $(...) 仍会执行），因此返回错误。
+func quoteActions(tree *parse.Tree, node parse.Node, state byte) (byte, error) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return state, nil
+		}
+		for _, child := range n.Nodes {
+			var err error
+			if state, err = quoteActions(tree, child, state); err != nil {
+				return 0, err
+			}
+		}
+	case *parse.TextNode:
+		state = scanQuotes(state, string(n.Text))
+	case *parse.ActionNode:
+		// {{$x := ...}} 只声明变量，不输出
+		if len(n.Pipe.Decl) > 0 {
+			return state, nil
+		}
+		if state != 0 {
+			return 0, fmt.Errorf("%s 位于引号内或 \\ 之后；变量的值会自动加引号，不要再手动加引号", n)
+		}
+		ident := parse.NewIdentifier("shquote").SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+	case *parse.IfNode:
+		return quoteBranches(tree, &n.BranchNode, state)
+	case *parse.RangeNode:
+		return quoteBranches(tree, &n.BranchNode, state)
+	case *parse.WithNode:
+		return quoteBranches(tree, &n.BranchNode, state)
+	}
+	return state, nil
+}
+
+// quoteBranches 处理 if、range、with 的各个分支。每个分支结束时必须处于相同的引号中，
+// range 的循环体还要回到开始时的引号，否则无法确定之后的动作是否位于引号内。
+func quoteBranches(tree *parse.Tree, n *parse.BranchNode, state byte) (byte, error) {
+	end, err := quoteActions(tree, n.List, state)
+	if err != nil {
+		return 0, err
+	}
+	elseEnd, err := quoteActions(tree, n.ElseList, state)
+	if err != nil {
+		return 0, err
+	}
+	if end != elseEnd || (n.Type() == parse.NodeRange && end != state) {
+		return 0, fmt.Errorf("%s 的各个分支中引号不配对", n)
+	}
+	return end, nil
+}
+
+// scanQuotes 从 state 开始扫描 shell 命令文本，返回扫描结束时所处的引号：
+// 0 表示不在引号内，单引号或双引号表示位于相应的引号内，反斜杠表示文本以转义用的 \ 结尾。
+// Windows 的 cmd 只识别双引号。
+func scanQuotes(state byte, text string) byte {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if runtime.GOOS == "windows" {
+			if c == '"' {
+				state ^= '"'
+			}
+			continue
+		}
+		switch state {
+		case '\\':
+			state = 0
+		case '\'':
+			if c == '\'' {
+				state = 0
+			}
+		case '"':
+			if c == '"' {
+				state = 0
+			} else if c == '\\' {
+				i++
+			}
+		default:
+			if c == '\\' || c == '\'' || c == '"' {
+				state = c
+			}
+		}
+	}
+	return state
+}
+
+// shellQuote 将 v 转换为 shell 中的单个参数：POSIX shell 使用单引号，Windows 的 cmd 使用双引号。
+func shellQuote(v any) string {
+	s := fmt.Sprint(v)
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func executeCheck(tmpl *template.Template, text string, values map[string]any) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("渲染检查 %q 失败: %w", text, err)
+	}
+	return buf.String(), nil
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// checkEnvNames 是检查命令可以继承的环境变量，其他变量（如凭据）不会传递给命令。
+var checkEnvNames = map[string]bool{
+	"PATH": true, "HOME": true, "USER": true, "LANG": true, "LC_ALL": true, "TERM": true,
+	"TMPDIR": true, "TEMP": true, "TMP": true, "SYSTEMROOT": true, "COMSPEC": true, "PATHEXT": true,
+	"USERPROFILE": true, "APPDATA": true, "LOCALAPPDATA": true,
+}
+
+// checkEnv 过滤出检查命令可以使用的环境变量，Go 工具链的配置（GOPATH、GOPROXY 等）也会保留。
+func checkEnv(environ []string) []string {
+	var env []string
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if checkEnvNames[strings.ToUpper(key)] || strings.HasPrefix(key, "GO") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// tail 返回 s 的最后 n 个字节。
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "...\n" + strings.ToValidUTF8(s[len(s)-n:], "")
+}
@@ -0,0 +1,128 @@
+package templates
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// hostileValues 是包含 shell 元字符的变量值，渲染后必须原样作为一个参数传给命令。
+var hostileValues = []string{
+	"plain",
+	"with space",
+	"it's",
+	"''",
+	"$(echo PWNED)",
+	"`echo PWNED`",
+	"${HOME}",
+	"a; echo PWNED",
+	"a && echo PWNED #",
+	"line1\nline2",
+	`back\slash "double"`,
+	"",
+}
+
+func TestShellQuote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("使用 POSIX shell")
+	}
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"plain", "'plain'"},
+		{"it's", `'it'\''s'`},
+		{"$(id)", "'$(id)'"},
+		{"`id`", "'`id`'"},
+		{"a\nb", "'a\nb'"},
+		{"", "''"},
+		{42, "'42'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %q，期望 %q", tt.in, got, tt.want)
+		}
+	}
+	for _, v := range hostileValues {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(v)).Output()
+		if err != nil {
+			t.Fatalf("%q: %v", v, err)
+		}
+		if string(out) != v {
+			t.Errorf("shell 收到的参数为 %q，期望 %q", out, v)
+		}
+	}
+}
+
+func TestRenderCheckCommandQuotesValues(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("使用 POSIX shell")
+	}
+	commands := []string{
+		"printf %s {{Name}}",
+		"printf %s {{.Name}}",
+		"printf %s {{Name | printf \"%s\"}}",
+		"{{if Name}}printf %s {{Name}}{{end}}",
+		"{{with .Name}}printf %s {{.}}{{end}}",
+		`printf "%s" {{Name}}`,
+		"printf %s {{Name}} # 'comment'",
+	}
+	for _, command := range commands {
+		for _, v := range hostileValues {
+			if v == "" && strings.Contains(command, "if") {
+				continue
+			}
+			rendered, err := renderCheckCommand(command, map[string]any{"Name": v})
+			if err != nil {
+				t.Fatalf("%s (%q): %v", command, v, err)
+			}
+			out, err := exec.Command("sh", "-c", rendered).Output()
+			if err != nil {
+				t.Fatalf("%s (%q): 运行 %q 失败: %v", command, v, rendered, err)
+			}
+			if string(out) != v {
+				t.Errorf("%s: shell 收到的参数为 %q，期望 %q", command, out, v)
+			}
+		}
+	}
+}
+
+// TestRenderCheckCommandRejectsQuotedActions 确认位于引号内或 \ 之后的动作被拒绝：
+// 双引号内的 '...' 不起作用，$(...) 和反引号仍会执行。
+func TestRenderCheckCommandRejectsQuotedActions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("使用 POSIX shell")
+	}
+	tests := []struct {
+		command string
+		err     string
+	}{
+		{`echo "{{Name}}"`, "位于引号内"},
+		{`echo "prefix-{{Name}}-suffix"`, "位于引号内"},
+		{`echo '{{Name}}'`, "位于引号内"},
+		{`echo "it's {{Name}}"`, "位于引号内"},
+		{`echo \{{Name}}`, "位于引号内"},
+		{`echo "{{if Name}}x{{end}}" {{Name}} "{{Name}}"`, "位于引号内"},
+		{`echo {{if Name}}"{{end}}{{Name}}`, "引号不配对"},
+		{`echo {{range .List}}'{{end}}{{Name}}`, "引号不配对"},
+	}
+	for _, tt := range tests {
+		_, err := renderCheckCommand(tt.command, map[string]any{"Name": "$(echo PWNED)", "List": []string{"a"}})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: 错误为 %v，期望包含 %q", tt.command, err, tt.err)
+		}
+	}
+	// 引号闭合之后的动作仍然可以使用，转义的引号不会开始引号
+	for _, command := range []string{
+		`echo "done:" {{Name}}`,
+		`echo 'it''s' {{Name}}`,
+		`echo "say \"hi\"" {{Name}}`,
+		`echo it\'s {{Name}}`,
+		`echo {{$n := Name}}{{$n}}`,
+	} {
+		if _, err := renderCheckCommand(command, map[string]any{"Name": "x"}); err != nil {
+			t.Errorf("%s: %v", command, err)
+		}
+	}
+}
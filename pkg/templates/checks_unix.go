@@ -0,0 +1,16 @@
+//go:build !windows
+
+package templates
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// isolateProcess 让检查命令运行在独立的进程组中，超时后终止整个进程组（包括命令启动的子进程）。
+func isolateProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
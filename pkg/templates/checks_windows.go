@@ -0,0 +1,8 @@
+//go:build windows
+
+package templates
+
+import "os/exec"
+
+// isolateProcess 在 Windows 上只终止命令本身，由 WaitDelay 避免等待仍在运行的子进程。
+func isolateProcess(cmd *exec.Cmd) {}
@@ -0,0 +1,174 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Computed 判断字段是否为计算字段（设置了 value 表达式）。
+func (f Field) Computed() bool {
+	return f.Value != ""
+}
+
+// ComputeFields 按依赖顺序计算 manifest 中的计算字段，结果写入 values。
+// 已有非空值的计算字段视为被用户覆盖，不再计算；表达式中引用的其他计算字段会先被计算。
+func ComputeFields(manifest *Manifest, values map[string]any) error {
+	if manifest == nil {
+		return nil
+	}
+	order, err := computeOrder(manifest)
+	if err != nil {
+		return err
+	}
+	for _, field := range order {
+		if !isEmptyValue(values[field.Name]) {
+			continue
+		}
+		tmpl, err := template.New(field.Name).Funcs(buildFuncMap(values)).Option("missingkey=error").Parse(field.Value)
+		if err != nil {
+			return fmt.Errorf("解析计算字段 %s 失败: %w", field.Name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, values); err != nil {
+			return fmt.Errorf("计算字段 %s 失败: %w", field.Name, err)
+		}
+		value, err := parseFieldValue(field, buf.String())
+		if err != nil {
+			return err
+		}
+		values[field.Name] = value
+	}
+	return nil
+}
+
+// computeOrder 返回按依赖拓扑排序的计算字段，存在循环依赖时返回错误。
+func computeOrder(manifest *Manifest) ([]Field, error) {
+	computed := map[string]Field{}
+	var names []string
+	for _, f := range manifest.Fields {
+		if f.Computed() {
+			computed[f.Name] = f
+			names = append(names, f.Name)
+		}
+	}
+
+	deps := map[string][]string{}
+	for _, name := range names {
+		refs, err := templateRefs(computed[name].Value)
+		if err != nil {
+			return nil, fmt.Errorf("解析计算字段 %s 失败: %w", name, err)
+		}
+		for _, ref := range refs {
+			if _, ok := computed[ref]; ok {
+				deps[name] = append(deps[name], ref)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var order []Field
+	var stack []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			// 从栈中截取出环
+			start := 0
+			for i, n := range stack {
+				if n == name {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, stack[start:]...), name)
+			return fmt.Errorf("计算字段存在循环依赖: %s", strings.Join(cycle, " -> "))
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		order = append(order, computed[name])
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// templateRefs 返回模板表达式中引用的变量名，包括 {{Name}} 和 {{.Name}} 两种写法。
+func templateRefs(text string) ([]string, error) {
+	tree := parse.New("expr")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", map[string]*parse.Tree{}); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var refs []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			refs = append(refs, name)
+		}
+	}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.IdentifierNode:
+			add(n.Ident)
+		case *parse.FieldNode:
+			add(n.Ident[0])
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	walk(tree.Root)
+	return refs, nil
+}
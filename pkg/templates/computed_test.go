@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// orderNames 返回 computeOrder 的结果中的字段名。
+func orderNames(t *testing.T, fields []Field) ([]string, error) {
+	t.Helper()
+	order, err := computeOrder(&Manifest{Fields: fields})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range order {
+		names = append(names, f.Name)
+	}
+	return names, nil
+}
+
+func TestComputeOrderDiamond(t *testing.T) {
+	// Full 依赖 Left 和 Right，两者都依赖 Base；Full 在 manifest 中最先声明
+	names, err := orderNames(t, []Field{
+		{Name: "Full", Value: "{{Left}}/{{Right}}"},
+		{Name: "Left", Value: "{{Base}}-l"},
+		{Name: "Right", Value: "{{.Base}}-r"},
+		{Name: "Base", Value: "{{kebab Name}}"},
+		{Name: "Name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Base", "Left", "Right", "Full"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("顺序为 %q，期望 %q", names, want)
+	}
+}
+
+func TestComputeOrderInputField(t *testing.T) {
+	// 引用输入字段和未声明的变量不产生依赖，输入字段不出现在结果中
+	names, err := orderNames(t, []Field{
+		{Name: "Module", Value: "github.com/{{Org}}/{{Name}}"},
+		{Name: "Name"},
+		{Name: "Org", Default: "acme"},
+		{Name: "Package", Value: "{{snake Name}}{{if Missing}}x{{end}}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Module", "Package"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("顺序为 %q，期望 %q", names, want)
+	}
+}
+
+func TestComputeOrderCycle(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []Field
+		cycle  string
+	}{
+		{"自身", []Field{{Name: "A", Value: "{{A}}x"}}, "A -> A"},
+		{"两个字段", []Field{
+			{Name: "A", Value: "{{B}}"},
+			{Name: "B", Value: "{{.A}}"},
+		}, "A -> B -> A"},
+		{"环之前有其他字段", []Field{
+			{Name: "Top", Value: "{{A}}"},
+			{Name: "A", Value: "{{B}}"},
+			{Name: "B", Value: "{{C}}"},
+			{Name: "C", Value: "{{if A}}{{A}}{{end}}"},
+		}, "A -> B -> C -> A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := orderNames(t, tt.fields)
+			if err == nil || !strings.HasSuffix(err.Error(), "循环依赖: "+tt.cycle) {
+				t.Fatalf("错误为 %v，期望循环依赖 %s", err, tt.cycle)
+			}
+		})
+	}
+}
+
+func TestComputeFields(t *testing.T) {
+	manifest := &Manifest{Fields: []Field{
+		{Name: "Full", Value: "{{Left}}/{{Right}}"},
+		{Name: "Left", Value: "{{Base}}-l"},
+		{Name: "Right", Value: "{{Base}}-r"},
+		{Name: "Base", Value: "{{kebab Name}}"},
+		{Name: "Name"},
+	}}
+	values := map[string]any{"Name": "MyApp", "Right": "custom"}
+	if err := ComputeFields(manifest, values); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"Name": "MyApp", "Base": "my-app", "Left": "my-app-l", "Right": "custom", "Full": "my-app-l/custom"}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("结果为 %v，期望 %v", values, want)
+	}
+
+	// 引用缺失的输入字段时报告字段名
+	err := ComputeFields(&Manifest{Fields: []Field{{Name: "X", Value: "{{.Missing}}"}}}, map[string]any{})
+	if err == nil || !strings.Contains(err.Error(), "计算字段 X 失败") {
+		t.Fatalf("错误为 %v，期望计算字段 X 失败", err)
+	}
+}
@@ -0,0 +1,93 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// ResolveDefaults 基于已填写的变量计算所有输入字段的建议默认值，供 Web 表单刷新未修改的字段。
+// 计算失败的字段（例如引用的变量尚未填写）不会出现在结果中。
+func ResolveDefaults(manifest *Manifest, values map[string]any) map[string]string {
+	defaults := map[string]string{}
+	if manifest == nil {
+		return defaults
+	}
+	for _, field := range manifest.Fields {
+		if field.Computed() {
+			continue
+		}
+		if def, err := evalDefault(manifest, values, field.Name); err == nil {
+			defaults[field.Name] = def
+		}
+	}
+	return defaults
+}
+
+// evalDefault 计算字段的默认值。
+// 默认值包含 {{ 时作为模板表达式，基于 values 计算；引用的字段尚未填写时，先惰性计算该字段的默认值。
+func evalDefault(manifest *Manifest, values map[string]any, name string) (string, error) {
+	e := &defaultEvaluator{
+		fields:    map[string]Field{},
+		values:    values,
+		resolving: map[string]bool{},
+	}
+	for _, f := range manifest.Fields {
+		e.fields[f.Name] = f
+	}
+	return e.eval(name)
+}
+
+type defaultEvaluator struct {
+	fields    map[string]Field
+	values    map[string]any
+	resolving map[string]bool // 正在计算的字段，用于检测循环引用
+}
+
+func (e *defaultEvaluator) eval(name string) (string, error) {
+	field := e.fields[name]
+	if !strings.Contains(field.Default, "{{") {
+		return field.Default, nil
+	}
+	if e.resolving[name] {
+		return "", fmt.Errorf("字段 %s 的默认值存在循环引用", name)
+	}
+	e.resolving[name] = true
+	defer delete(e.resolving, name)
+
+	refs, err := templateRefs(field.Default)
+	if err != nil {
+		return "", fmt.Errorf("解析字段 %s 的默认值失败: %w", name, err)
+	}
+	// 表达式只能引用已声明的字段和内置变量，其他变量（如请求中多余的键）不参与计算
+	ctx := make(map[string]any, len(e.fields))
+	for k, v := range e.values {
+		if _, ok := e.fields[k]; ok || IsBuiltin(k) {
+			ctx[k] = v
+		}
+	}
+	for _, ref := range refs {
+		dep, ok := e.fields[ref]
+		if !ok || dep.Computed() || !isEmptyValue(ctx[ref]) {
+			continue
+		}
+		v, err := e.eval(ref)
+		if err != nil {
+			return "", err
+		}
+		if ctx[ref], err = parseFieldValue(dep, v); err != nil {
+			return "", err
+		}
+	}
+
+	tmpl, err := template.New(name).Funcs(buildFuncMap(ctx)).Option("missingkey=error").Parse(field.Default)
+	if err != nil {
+		return "", fmt.Errorf("解析字段 %s 的默认值失败: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return "", fmt.Errorf("计算字段 %s 的默认值失败: %w", name, err)
+	}
+	return buf.String(), nil
+}
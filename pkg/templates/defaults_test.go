@@ -0,0 +1,71 @@
+package templates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvalDefault(t *testing.T) {
+	manifest := &Manifest{Fields: []Field{
+		{Name: "Org", Default: "acme"},
+		{Name: "Name", Default: "{{Org}}-svc"},
+		{Name: "Module", Default: "github.com/{{Org}}/{{Name}}"},
+		{Name: "Ping", Default: "{{Pong}}"},
+		{Name: "Pong", Default: "{{Ping}}"},
+		{Name: "Dangling", Default: "{{Undeclared}}"},
+		{Name: "Year", Default: "{{Year}}"},
+	}}
+	tests := []struct {
+		name   string
+		field  string
+		values map[string]any
+		want   string
+		err    string
+	}{
+		{name: "字面量", field: "Org", want: "acme"},
+		{name: "惰性计算依赖", field: "Module", want: "github.com/acme/acme-svc"},
+		{name: "已填写的值优先", field: "Module", values: map[string]any{"Org": "corp"}, want: "github.com/corp/corp-svc"},
+		{name: "中间字段已填写", field: "Module", values: map[string]any{"Name": "api"}, want: "github.com/acme/api"},
+		{name: "内置变量", field: "Year", values: map[string]any{"Year": "2024"}, want: "2024"},
+		{name: "循环引用", field: "Ping", err: "循环引用"},
+		{name: "引用不存在的变量", field: "Dangling", err: "Undeclared"},
+		{name: "未声明的变量不参与计算", field: "Dangling", values: map[string]any{"Undeclared": "x"}, err: "Undeclared"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := tt.values
+			if values == nil {
+				values = map[string]any{}
+			}
+			got, err := evalDefault(manifest, values, tt.field)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("错误为 %v，期望包含 %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("默认值为 %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApplyDefaultsRejectsInvalidNames 确认不是标识符的变量名在计算默认值之前被拒绝，而不是让模板 panic。
+func TestApplyDefaultsRejectsInvalidNames(t *testing.T) {
+	manifest := &Manifest{Fields: []Field{{Name: "Name", Default: "{{Org}}"}, {Name: "Org", Default: "acme"}}}
+	for _, name := range []string{"a.b", "bad-key", "1x", ""} {
+		err := ApplyDefaults(manifest, map[string]any{name: "x"})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != name {
+			t.Errorf("%q: 错误为 %v，期望该变量的 ValidationError", name, err)
+		}
+	}
+	if defaults := ResolveDefaults(manifest, map[string]any{"a.b": "x"}); defaults["Name"] != "acme" {
+		t.Errorf("ResolveDefaults 结果为 %v", defaults)
+	}
+}
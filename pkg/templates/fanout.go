@@ -0,0 +1,103 @@
+package templates
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// RenderOptions 控制渲染行为，通常通过 Manifest.RenderOptions 获得。
+type RenderOptions struct {
+	Fanout []FanoutRule // fan-out 规则
+	// PartialDirs 是共享 partial 目录（如 ConfigDir/partials），靠后的目录优先；
+	// 模板自身的 _partials/ 目录优先级最高。
+	PartialDirs []string
+	// Layers 是优先级低于源目录的其他源目录（如 extends/include 的模板），按优先级从低到高；
+	// 同一相对路径的文件以优先级高的为准。
+	Layers []string
+	// Exclude 是不输出的源路径（相对源目录，使用 / 分隔），目录会连同内容一起排除。
+	Exclude []string
+	// Format 是生成文件的格式化规则，第一条匹配的规则生效。
+	Format []FormatRule
+	// TrimBlocks 为 true 时，只包含控制结构（if/range/end 等）、注释或变量赋值的行渲染后不留下空行。
+	TrimBlocks bool
+	// EOL 是生成文件的换行符规则，第一条匹配的规则生效。
+	EOL []EOLRule
+	// Modes 覆盖生成文件的权限，第一条匹配的规则生效；未匹配的文件沿用源文件的权限。
+	Modes []ModeRule
+	// CollectErrors 为 true 时，某个文件渲染失败后继续渲染其他文件，最后以 RenderErrors 返回所有错误；
+	// 默认在第一个错误处停止并返回 *RenderError。
+	CollectErrors bool
+	// Workers 是并发渲染文件内容的 worker 数量，0 表示使用 GOMAXPROCS，1 表示逐个渲染。
+	Workers int
+	// AllowExternalFormatters 为 true 时才运行格式化规则中的外部命令（run），否则匹配这些规则的文件保持原样。
+	// 外部命令可以执行任意程序，只应在信任模板时开启（如 CLI）；Web 服务不开启。
+	AllowExternalFormatters bool
+}
+
+// FanoutRule 让一个源文件按列表变量的每个元素各渲染一次。
+// 渲染该文件的路径和内容时，dot 绑定为当前元素（如 {{.name}}），其他变量仍可通过 {{变量名}} 访问。
+type FanoutRule struct {
+	Files string `json:"files" yaml:"files"`                   // 源文件路径（相对模板根目录，支持 * 通配）
+	Each  string `json:"each" yaml:"each"`                     // 列表变量名
+	Path  string `json:"path,omitempty" yaml:"path,omitempty"` // 目标路径模板，为空时使用源路径
+}
+
+// fanoutMarker 匹配路径中的 [[列表变量]] 标记，例如 handlers/[[Services]]{{.name}}.go。
+var fanoutMarker = regexp.MustCompile(`\[\[([A-Za-z_][A-Za-z0-9_]*)\]\]`)
+
+// RenderOptions 返回 manifest 中声明的渲染选项。
+func (m *Manifest) RenderOptions() RenderOptions {
+	if m == nil {
+		return RenderOptions{}
+	}
+	return RenderOptions{Fanout: m.Fanout, Format: m.Format, TrimBlocks: m.TrimBlocks != nil && *m.TrimBlocks, EOL: m.EOL, Modes: m.Modes}
+}
+
+// fanoutFor 返回源路径（使用 / 分隔）对应的 fan-out 规则，不需要 fan-out 时返回 nil。
+// 路径中的 [[变量]] 标记优先于 manifest 规则，标记本身会从目标路径中去掉。
+func (o RenderOptions) fanoutFor(rel string) (*FanoutRule, error) {
+	markers := fanoutMarker.FindAllStringSubmatch(rel, -1)
+	switch len(markers) {
+	case 0:
+	case 1:
+		return &FanoutRule{
+			Files: rel,
+			Each:  markers[0][1],
+			Path:  fanoutMarker.ReplaceAllString(rel, ""),
+		}, nil
+	default:
+		return nil, fmt.Errorf("路径 %s 包含多个 fan-out 标记", rel)
+	}
+
+	for _, rule := range o.Fanout {
+		matched, err := path.Match(rule.Files, rel)
+		if err != nil {
+			return nil, fmt.Errorf("fan-out 规则 %q 无效: %w", rule.Files, err)
+		}
+		if matched {
+			r := rule
+			if r.Path == "" {
+				r.Path = rel
+			}
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// listValue 取出列表变量。
+func listValue(values map[string]any, name string) ([]any, error) {
+	v, ok := values[name]
+	if !ok {
+		return nil, fmt.Errorf("fan-out 变量 %s 不存在", name)
+	}
+	switch list := v.(type) {
+	case []any:
+		return list, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("fan-out 变量 %s 不是列表", name)
+	}
+}
@@ -0,0 +1,228 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 内置格式化器。
+const (
+	FormatterGo   = "go"   // go/format，与 gofmt 相同
+	FormatterJSON = "json" // 重新缩进为两个空格
+	FormatterYAML = "yaml" // 重新缩进为两个空格，保留注释
+)
+
+// formatTimeout 是外部格式化命令的超时时间。
+const formatTimeout = 30 * time.Second
+
+// FormatRule 对匹配的生成文件进行格式化，with 和 run 二选一。
+// 外部命令从标准输入读取文件内容，把格式化结果写到标准输出，例如 terraform fmt -。
+type FormatRule struct {
+	Files string `json:"files" yaml:"files"`                   // 目标路径的 glob，支持 **；不含 / 时匹配文件名
+	With  string `json:"with,omitempty" yaml:"with,omitempty"` // 内置格式化器：go、json、yaml
+	Run   string `json:"run,omitempty" yaml:"run,omitempty"`   // 外部格式化命令
+}
+
+// validate 检查规则是否有效。
+func (r FormatRule) validate() error {
+	if r.Files == "" {
+		return fmt.Errorf("格式化规则缺少 files")
+	}
+	if _, err := globRegexp(r.Files); err != nil {
+		return fmt.Errorf("格式化规则 %q 无效: %w", r.Files, err)
+	}
+	if (r.With == "") == (r.Run == "") {
+		return fmt.Errorf("格式化规则 %q 需要且只能设置 with 或 run 之一", r.Files)
+	}
+	switch r.With {
+	case "", FormatterGo, FormatterJSON, FormatterYAML:
+		return nil
+	default:
+		return fmt.Errorf("格式化规则 %q 的格式化器 %q 无效，可选 go、json、yaml", r.Files, r.With)
+	}
+}
+
+// ExternalFormatters 返回 manifest 中格式化规则的外部命令。
+func (m *Manifest) ExternalFormatters() []string {
+	if m == nil {
+		return nil
+	}
+	var commands []string
+	for _, rule := range m.Format {
+		if rule.Run != "" {
+			commands = append(commands, rule.Run)
+		}
+	}
+	return commands
+}
+
+// formatFile 使用第一条匹配 rel（使用 / 分隔的目标路径）的规则格式化内容，没有匹配的规则时原样返回。
+// 未设置 AllowExternalFormatters 时，外部命令规则不会运行，匹配的文件原样返回。
+func (o RenderOptions) formatFile(ctx context.Context, rel string, content []byte) ([]byte, error) {
+	for _, rule := range o.Format {
+		matched, err := matchGlob(rule.Files, rel)
+		if err != nil {
+			return nil, fmt.Errorf("格式化规则 %q 无效: %w", rule.Files, err)
+		}
+		if !matched {
+			continue
+		}
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		if rule.Run != "" && !o.AllowExternalFormatters {
+			return content, nil
+		}
+		formatted, err := rule.apply(ctx, rel, content)
+		if err != nil {
+			return nil, fmt.Errorf("格式化 %s 失败: %w", rel, err)
+		}
+		return formatted, nil
+	}
+	return content, nil
+}
+
+func (r FormatRule) apply(ctx context.Context, rel string, content []byte) ([]byte, error) {
+	switch r.With {
+	case FormatterGo:
+		return format.Source(content)
+	case FormatterJSON:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, bytes.TrimSpace(content), "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case FormatterYAML:
+		return formatYAML(content)
+	default:
+		return runFormatter(ctx, r.Run, rel, content)
+	}
+}
+
+// formatYAML 逐个文档重新编码 YAML，保留注释和键的顺序。
+func formatYAML(content []byte) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runFormatter 运行外部格式化命令，文件内容通过标准输入传入，目标路径通过 KUAI_FILE 环境变量提供；ctx 取消或超时后命令被终止。
+func runFormatter(ctx context.Context, command, rel string, content []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, formatTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(checkEnv(os.Environ()), "KUAI_FILE="+rel)
+	isolateProcess(cmd)
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(content)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("命令 %q 超时（%s）", command, formatTimeout)
+		}
+		return nil, fmt.Errorf("命令 %q 失败: %v: %s", command, err, strings.TrimSpace(tail(stderr.String(), maxCheckOutput)))
+	}
+	return stdout.Bytes(), nil
+}
+
+// matchGlob 判断目标路径（使用 / 分隔）是否匹配 glob；不含 / 的模式只匹配文件名。
+func matchGlob(pattern, rel string) (bool, error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return false, err
+	}
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+	return re.MatchString(rel), nil
+}
+
+// globCache 缓存编译好的 glob，渲染每个文件时都要匹配 format、eol、modes 规则。
+var globCache sync.Map // pattern -> *regexp.Regexp
+
+// globRegexp 将 glob 转换为正则表达式：* 和 ? 不匹配 /，** 匹配任意层目录，[...] 为字符集合。
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := globCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := compileGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	globCache.Store(pattern, re)
+	return re, nil
+}
+
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// **/ 匹配零或多层目录
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("缺少 ]")
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
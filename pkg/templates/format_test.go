@@ -0,0 +1,132 @@
+package templates
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/app/main.go", true},
+		{"*.go", "main.go.tmpl", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "cmd/app/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/app/main.go", true},
+		{"cmd/**", "cmd/app/main.go", true},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"[!a]*.txt", "b.txt", true},
+		{"[!a]*.txt", "a.txt", false},
+	}
+	for _, tt := range tests {
+		got, err := matchGlob(tt.pattern, tt.rel)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		if got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v，期望 %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+	if _, err := matchGlob("[abc", "a"); err == nil {
+		t.Error("缺少 ] 的 glob 应该报错")
+	}
+}
+
+func TestFormatFileFirstMatch(t *testing.T) {
+	opts := RenderOptions{
+		AllowExternalFormatters: true,
+		Format: []FormatRule{
+			{Files: "gen/*.json", Run: "tr a-z A-Z"},
+			{Files: "*.json", With: FormatterJSON},
+			{Files: "**", Run: "false"},
+		},
+	}
+	tests := []struct {
+		rel  string
+		in   string
+		want string
+	}{
+		{"gen/a.json", `{"a":1}`, `{"A":1}`},
+		{"b.json", `{"a":1}`, "{\n  \"a\": 1\n}\n"},
+		{"gen/sub/c.json", `{"a":1}`, "{\n  \"a\": 1\n}\n"},
+	}
+	for _, tt := range tests {
+		got, err := opts.formatFile(context.Background(), tt.rel, []byte(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.rel, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s 格式化为 %q，期望 %q", tt.rel, got, tt.want)
+		}
+	}
+	// 只匹配最后一条规则的文件会运行 false 并失败
+	if _, err := opts.formatFile(context.Background(), "README.md", []byte("x")); err == nil {
+		t.Error("期望 README.md 格式化失败")
+	}
+}
+
+func TestFormatFileNoMatch(t *testing.T) {
+	opts := RenderOptions{Format: []FormatRule{{Files: "*.go", With: FormatterGo}}}
+	got, err := opts.formatFile(context.Background(), "main.go.tmpl", []byte("package  main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "package  main" {
+		t.Errorf("未匹配的文件被修改为 %q", got)
+	}
+}
+
+func TestFormatFileCommandFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+	}{
+		{"退出码非零", "false", []string{"格式化 out.tf 失败", `命令 "false" 失败`}},
+		{"标准错误", "echo bad input on $KUAI_FILE >&2; exit 3", []string{"格式化 out.tf 失败", "exit status 3", "bad input on out.tf"}},
+		{"命令不存在", "kuai-no-such-formatter", []string{"格式化 out.tf 失败"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := RenderOptions{
+				AllowExternalFormatters: true,
+				Format:                  []FormatRule{{Files: "*.tf", Run: tt.command}},
+			}
+			_, err := opts.formatFile(context.Background(), "out.tf", []byte("x"))
+			if err == nil {
+				t.Fatal("期望格式化失败")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("错误 %q 不包含 %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatFileExternalNotAllowed(t *testing.T) {
+	opts := RenderOptions{Format: []FormatRule{{Files: "*.tf", Run: "false"}}}
+	got, err := opts.formatFile(context.Background(), "out.tf", []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "x" {
+		t.Errorf("未允许外部命令时内容被修改为 %q", got)
+	}
+}
+
+func TestFormatFileBuiltinFailure(t *testing.T) {
+	opts := RenderOptions{Format: []FormatRule{{Files: "*.go", With: FormatterGo}}}
+	_, err := opts.formatFile(context.Background(), "main.go", []byte("package main\nfunc {"))
+	if err == nil || !strings.Contains(err.Error(), "格式化 main.go 失败") {
+		t.Fatalf("错误为 %v，期望格式化 main.go 失败", err)
+	}
+}
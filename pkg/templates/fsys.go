@@ -0,0 +1,84 @@
+package templates
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ReadLinkFS 是可以读取符号链接的文件系统，DirFS 返回的文件系统实现了该接口。
+// 源文件系统中的符号链接在渲染时会被重建，源文件系统需要实现该接口才能读取链接目标。
+type ReadLinkFS interface {
+	fs.FS
+	// ReadLink 返回符号链接 name 的目标，name 是使用 / 分隔的相对路径。
+	ReadLink(name string) (string, error)
+}
+
+// DirFS 返回以 dir 为根目录的文件系统，与 os.DirFS 相同，另外实现了 ReadLinkFS。
+// DirFS 中的文件和目录渲染后沿用源文件的权限；其他文件系统（如 embed.FS、fstest.MapFS）的权限不可靠，
+// 生成的文件为 0644、目录为 0755，只保留源文件的可执行位。
+func DirFS(dir string) fs.FS {
+	return dirFS{FS: os.DirFS(dir), root: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	root string
+}
+
+func (d dirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(d.root, filepath.FromSlash(name)))
+}
+
+// Sub 返回子目录的 DirFS，子目录同样支持 ReadLink。
+func (d dirFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	return DirFS(filepath.Join(d.root, filepath.FromSlash(dir))), nil
+}
+
+// diskPath 返回 name 在磁盘上的路径，fsys 不是 DirFS 时返回空字符串。
+func diskPath(fsys fs.FS, name string) string {
+	if d, ok := fsys.(dirFS); ok {
+		return filepath.Join(d.root, filepath.FromSlash(name))
+	}
+	return ""
+}
+
+// readLink 读取 fsys 中的符号链接，目标统一使用 / 分隔。
+func readLink(fsys fs.FS, name string) (string, error) {
+	rl, ok := fsys.(ReadLinkFS)
+	if !ok {
+		return "", fmt.Errorf("无法读取符号链接 %s: 文件系统不支持 ReadLink", name)
+	}
+	target, err := rl.ReadLink(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(target), nil
+}
+
+// sourceMode 返回源文件用于生成结果的权限，见 DirFS。
+func sourceMode(fsys fs.FS, info fs.FileInfo) fs.FileMode {
+	if _, ok := fsys.(dirFS); ok {
+		return info.Mode().Perm()
+	}
+	if info.IsDir() {
+		return 0o755
+	}
+	return 0o644 | info.Mode().Perm()&0o111
+}
+
+// dirFSList 将磁盘目录转换为文件系统。
+func dirFSList(dirs []string) []fs.FS {
+	list := make([]fs.FS, len(dirs))
+	for i, dir := range dirs {
+		list[i] = DirFS(dir)
+	}
+	return list
+}
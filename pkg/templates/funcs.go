@@ -0,0 +1,69 @@
+package templates
+
+import (
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// helperFuncs 是模板、默认值表达式和计算字段中可用的字符串辅助函数，
+// 例如 {{kebab Name}}、{{upper (snake Name)}}。同名变量优先于辅助函数。
+var helperFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"kebab":   func(s string) string { return strings.ToLower(strings.Join(splitWords(s), "-")) },
+	"snake":   func(s string) string { return strings.ToLower(strings.Join(splitWords(s), "_")) },
+	"camel":   toCamel,
+	"pascal":  toPascal,
+}
+
+// splitWords 按分隔符和大小写边界拆分单词，例如 "userAPIServer" -> user, API, Server。
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(s)
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := current[len(current)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			// aB 或 ABc 中的 B 开始新单词
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return words
+}
+
+func toPascal(s string) string {
+	var b strings.Builder
+	for _, w := range splitWords(s) {
+		runes := []rune(strings.ToLower(w))
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
+
+func toCamel(s string) string {
+	p := []rune(toPascal(s))
+	if len(p) == 0 {
+		return ""
+	}
+	p[0] = unicode.ToLower(p[0])
+	return string(p)
+}
@@ -0,0 +1,308 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TestsDir 是模板中存放测试用例的目录：tests/<case>/values.yaml 为输入，tests/<case>/expected/ 为期望输出。
+const TestsDir = "tests"
+
+// TestResult 是单个测试用例的结果。
+type TestResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Updated  bool          `json:"updated,omitempty"` // 使用 --update 重新生成了期望输出
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"` // 加载变量或渲染失败
+	Diffs    []FileDiff    `json:"diffs,omitempty"`
+	Checks   []CheckResult `json:"checks,omitempty"` // manifest 中 checks 的结果
+}
+
+// FileDiff 描述渲染结果与期望输出之间的一处差异。
+type FileDiff struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"` // missing：期望存在但未生成；unexpected：多生成的文件；changed：内容不同
+	Diff string `json:"diff,omitempty"`
+}
+
+// testBuiltins 返回测试时使用的固定内置变量，保证期望输出不随日期、机器和 git 配置变化。
+func testBuiltins(templateName, caseName string) map[string]string {
+	return map[string]string{
+		"TemplateName": templateName,
+		"Year":         "2006",
+		"Date":         "2006-01-02",
+		"TargetDir":    caseName,
+		"TargetBase":   caseName,
+		"GitUserName":  "",
+		"GitUserEmail": "",
+		"GOOS":         "linux",
+		"KuaiVersion":  "test",
+	}
+}
+
+// TestCases 返回模板中的测试用例名称（已排序）。
+func TestCases(templatePath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(templatePath, TestsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hasTestCases 判断 tests/ 是否为 kuai 测试用例目录（而不是要生成的项目中的 tests/ 目录）：
+// 至少一个子目录包含 expected/ 或 values 文件。
+func hasTestCases(templatePath string) bool {
+	cases, err := TestCases(templatePath)
+	if err != nil {
+		return false
+	}
+	for _, name := range cases {
+		for _, marker := range []string{"expected", "values.yaml", "values.yml", "values.json"} {
+			if _, err := os.Stat(filepath.Join(templatePath, TestsDir, name, marker)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RunTests 渲染模板的每个测试用例，并与 tests/<case>/expected/ 比较，同时对渲染结果运行 manifest 中的检查。
+// update 为 true 时用渲染结果覆盖期望输出。cases 为空时运行全部用例；
+// 指定的用例必须是 TestCases 返回的名称，否则在渲染或删除任何文件之前返回错误。
+func RunTests(resolved *ResolvedTemplate, opts RenderOptions, update bool, cases ...string) ([]TestResult, error) {
+	known, err := TestCases(resolved.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		cases = known
+	}
+	exists := make(map[string]bool, len(known))
+	for _, name := range known {
+		exists[name] = true
+	}
+	for _, name := range cases {
+		if !exists[name] {
+			return nil, fmt.Errorf("模板 %s 没有测试用例 %q，可选: %s", resolved.Name, name, strings.Join(known, ", "))
+		}
+	}
+	results := make([]TestResult, 0, len(cases))
+	for _, name := range cases {
+		start := time.Now()
+		result := runTestCase(resolved, opts, name, update)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func runTestCase(resolved *ResolvedTemplate, opts RenderOptions, name string, update bool) TestResult {
+	result := TestResult{Name: name}
+	caseDir := filepath.Join(resolved.Path, TestsDir, name)
+	expectedDir := filepath.Join(caseDir, "expected")
+
+	values := map[string]any{}
+	for _, file := range []string{"values.yaml", "values.yml", "values.json"} {
+		path := filepath.Join(caseDir, file)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		loaded, err := loadValuesFile(path)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		values = loaded
+		break
+	}
+	MergeBuiltins(resolved.Manifest, values, testBuiltins(resolved.Name, name))
+	if err := ApplyDefaults(resolved.Manifest, values); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := ComputeFields(resolved.Manifest, values); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	outDir, err := os.MkdirTemp("", "kuai-test-*")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer os.RemoveAll(outDir)
+	if err := RenderWithOptions(resolved.SourceDir(), outDir, values, opts); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	checks, err := RunChecks(resolved.Manifest.Checks, outDir, values)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Checks = checks
+	checksPassed := true
+	for _, c := range checks {
+		checksPassed = checksPassed && c.Passed
+	}
+
+	if update {
+		if err := os.RemoveAll(expectedDir); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if err := copyDir(outDir, expectedDir); err != nil {
+			result.Error = fmt.Sprintf("更新期望输出失败: %v", err)
+			return result
+		}
+		// 临时目录的权限是 0700，期望输出目录使用普通目录的权限
+		if err := os.Chmod(expectedDir, 0o755); err != nil {
+			result.Error = fmt.Sprintf("更新期望输出失败: %v", err)
+			return result
+		}
+		result.Passed = checksPassed
+		result.Updated = true
+		return result
+	}
+
+	diffs, err := compareTrees(expectedDir, outDir)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Diffs = diffs
+	result.Passed = len(diffs) == 0 && checksPassed
+	return result
+}
+
+// compareTrees 比较两个目录中的文件（忽略空目录），返回按路径排序的差异。
+func compareTrees(expectedDir, actualDir string) ([]FileDiff, error) {
+	expected, err := readTree(expectedDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取期望输出失败: %w", err)
+	}
+	actual, err := readTree(actualDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []FileDiff
+	for path, want := range expected {
+		got, ok := actual[path]
+		switch {
+		case !ok:
+			diffs = append(diffs, FileDiff{Path: path, Kind: "missing"})
+		case !bytes.Equal(want, got):
+			diffs = append(diffs, FileDiff{Path: path, Kind: "changed", Diff: lineDiff(want, got)})
+		}
+	}
+	for path := range actual {
+		if _, ok := expected[path]; !ok {
+			diffs = append(diffs, FileDiff{Path: path, Kind: "unexpected"})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+// readTree 读取目录中的所有文件，键为 / 分隔的相对路径；目录不存在时返回空集合。
+func readTree(dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return files, nil
+	}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		// 符号链接按链接目标比较，不跟随
+		if entry.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = []byte("-> " + filepath.ToSlash(target))
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return files, err
+}
+
+// maxDiffLines 限制单个文件输出的 diff 行数。
+const maxDiffLines = 50
+
+// lineDiff 返回按行比较的差异，"-" 为期望内容，"+" 为实际内容。
+func lineDiff(want, got []byte) string {
+	if isBinary(want) || isBinary(got) {
+		return "二进制文件内容不同"
+	}
+	a := strings.Split(string(want), "\n")
+	b := strings.Split(string(got), "\n")
+	if len(a)*len(b) > 1_000_000 {
+		return "文件过大，省略 diff"
+	}
+
+	// 最长公共子序列
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, fmt.Sprintf("%d: + %s", j+1, b[j]))
+			j++
+		default:
+			lines = append(lines, fmt.Sprintf("%d: - %s", i+1, a[i]))
+			i++
+		}
+	}
+	if len(lines) > maxDiffLines {
+		lines = append(lines[:maxDiffLines], fmt.Sprintf("... 省略 %d 行", len(lines)-maxDiffLines))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,86 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newGoldenTemplate 创建带有一个测试用例 basic 的模板，返回展开后的模板。
+func newGoldenTemplate(t *testing.T) *ResolvedTemplate {
+	t.Helper()
+	m := newTestManager(t, map[string]map[string]string{
+		"demo": {
+			"kuai.yaml":                         "name: demo\nfields:\n  - name: Name\n",
+			"hello.txt":                         "hello {{.Name}}\n",
+			"tests/basic/values.yaml":           "Name: kuai\n",
+			"tests/basic/expected/hello.txt":    "hello kuai\n",
+			"tests/expected-stale/values.yaml":  "Name: new\n",
+			"tests/expected-stale/expected/old": "old\n",
+		},
+	})
+	resolved, err := m.Resolve("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolved
+}
+
+func TestRunTests(t *testing.T) {
+	resolved := newGoldenTemplate(t)
+	results, err := RunTests(resolved, resolved.RenderOptions(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Name != "basic" || results[1].Name != "expected-stale" {
+		t.Fatalf("结果为 %+v，期望 basic 和 expected-stale", results)
+	}
+	if !results[0].Passed {
+		t.Errorf("basic 应该通过: %+v", results[0])
+	}
+	if results[1].Passed || len(results[1].Diffs) != 2 {
+		t.Errorf("expected-stale 应该有两处差异: %+v", results[1])
+	}
+
+	results, err = RunTests(resolved, resolved.RenderOptions(), true, "expected-stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Updated {
+		t.Fatalf("结果为 %+v，期望更新 expected-stale", results)
+	}
+	got := treeContents(t, filepath.Join(resolved.Path, TestsDir, "expected-stale", "expected"))
+	if len(got) != 1 || got["hello.txt"] != "hello new\n" {
+		t.Errorf("更新后的期望输出为 %q", got)
+	}
+}
+
+// TestRunTestsUnknownCase 确认拼错的用例名和路径形式的用例名在渲染和删除任何文件之前被拒绝。
+func TestRunTestsUnknownCase(t *testing.T) {
+	resolved := newGoldenTemplate(t)
+	// victim/expected 位于 tests/ 之外，tests/../../victim 会指向它
+	victim := filepath.Join(filepath.Dir(resolved.Path), "victim")
+	writeTree(t, filepath.Join(victim, "expected"), map[string]string{"keep.txt": "keep"})
+
+	for _, name := range []string{"basc", "../../victim", "basic/../basic", "/tmp", "", "."} {
+		results, err := RunTests(resolved, resolved.RenderOptions(), true, name)
+		if err == nil || !strings.Contains(err.Error(), "没有测试用例") {
+			t.Errorf("%q: 错误为 %v，期望没有测试用例", name, err)
+		}
+		if results != nil {
+			t.Errorf("%q: 不应返回结果 %+v", name, results)
+		}
+	}
+	// 有效用例和无效用例混在一起时也不运行任何用例
+	if _, err := RunTests(resolved, resolved.RenderOptions(), true, "expected-stale", "../../victim"); err == nil {
+		t.Error("包含无效用例时应该报错")
+	}
+	if _, err := os.Stat(filepath.Join(victim, "expected", "keep.txt")); err != nil {
+		t.Errorf("tests/ 之外的目录被删除: %v", err)
+	}
+	stale := treeContents(t, filepath.Join(resolved.Path, TestsDir, "expected-stale", "expected"))
+	if stale["old"] != "old\n" {
+		t.Errorf("有效用例的期望输出被更新: %q", stale)
+	}
+}
@@ -0,0 +1,659 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 检查问题的严重程度。
+const (
+	LintError   = "error"   // 会导致渲染失败或生成错误的结果
+	LintWarning = "warning" // 可能是疏漏，但不影响渲染
+)
+
+// LintIssue 是 Lint 发现的单个问题。
+type LintIssue struct {
+	Severity string `json:"severity"`
+	// Rule 是问题类别：manifest、syntax、undeclared、unused、partial、fanout、path、binary、unreadable。
+	Rule    string `json:"rule"`
+	File    string `json:"file,omitempty"` // 相对模板目录的路径
+	Line    int    `json:"line,omitempty"`
+	Col     int    `json:"col,omitempty"`
+	Message string `json:"message"`
+}
+
+// Location 返回 file:line:col 形式的位置，没有行列信息时省略。
+func (i LintIssue) Location() string {
+	loc := i.File
+	if i.Line > 0 {
+		loc += ":" + strconv.Itoa(i.Line)
+		if i.Col > 0 {
+			loc += ":" + strconv.Itoa(i.Col)
+		}
+	}
+	return loc
+}
+
+// templateBuiltinFuncs 是 text/template 自带的函数。
+var templateBuiltinFuncs = map[string]bool{
+	"and": true, "or": true, "not": true, "len": true, "index": true, "slice": true, "call": true,
+	"print": true, "printf": true, "println": true, "html": true, "js": true, "urlquery": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+}
+
+// pathSafeFuncs 会去掉 / 和 . 等分隔符，经过它们处理的变量不会让路径逃逸目标目录。
+var pathSafeFuncs = map[string]bool{"kebab": true, "snake": true, "camel": true, "pascal": true}
+
+var (
+	identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	wordPattern  = regexp.MustCompile(`[A-Za-z_]+`)
+)
+
+// Lint 对模板做比 Validate 更深入的检查：
+// 用 text/template 解析每个文件的路径和内容并报告语法错误的位置，检查使用了但未声明的变量、声明了但未使用的字段、
+// 不存在的 partial、可能渲染为 .. 或绝对路径的路径、会被当作模板解析的二进制或不可读文件，以及 manifest 的结构。
+// 只有模板自身的文件会被报告；extends/include 的模板只用于统计变量的使用情况。
+// 结果按文件和位置排序；模板不存在时返回错误。
+func (m *Manager) Lint(name string) ([]LintIssue, error) {
+	root, err := m.TemplatePath(name)
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{root: root, declared: map[string]bool{}, refs: map[string]bool{}, partials: map[string]bool{}}
+
+	own, ok := l.checkManifestSchema()
+	if !ok {
+		return l.sorted(), nil
+	}
+	resolved, err := m.Resolve(name)
+	if err != nil {
+		l.add(LintError, "manifest", l.manifestFile, 0, 0, err.Error())
+		return l.sorted(), nil
+	}
+	for _, f := range resolved.Manifest.Fields {
+		l.declared[f.Name] = true
+	}
+	opts := resolved.RenderOptions()
+
+	l.checkFields(own, resolved.Manifest)
+	l.checkChecks(own)
+	for _, rule := range own.Format {
+		if err := rule.validate(); err != nil {
+			l.add(LintError, "manifest", l.manifestFile, 0, 0, err.Error())
+		}
+	}
+	for _, rule := range own.EOL {
+		if err := rule.validate(); err != nil {
+			l.add(LintError, "manifest", l.manifestFile, 0, 0, err.Error())
+		}
+	}
+	for _, rule := range own.Modes {
+		if _, err := rule.parse(); err != nil {
+			l.add(LintError, "manifest", l.manifestFile, 0, 0, err.Error())
+		}
+	}
+	if err := l.checkPartials(append([]string{m.paths.PartialsDir}, opts.PartialDirs...)); err != nil {
+		return nil, err
+	}
+	sources, err := collectSources(dirFSList(append(append([]string{}, opts.Layers...), resolved.SourceDir())), opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	l.checkFanout(own, sources)
+	for _, src := range sources {
+		l.checkSource(src, resolved.SourceDir(), opts)
+	}
+	l.checkTemplateCalls()
+
+	// 只报告模板自身声明的字段，父模板中的字段由父模板负责
+	for _, f := range own.Fields {
+		if identPattern.MatchString(f.Name) && !l.refs[f.Name] {
+			l.add(LintWarning, "unused", l.manifestFile, 0, 0, fmt.Sprintf("字段 %s 已声明但未被使用", f.Name))
+		}
+	}
+	return l.sorted(), nil
+}
+
+type linter struct {
+	root         string
+	manifestFile string          // 模板自身 manifest 的相对路径，没有时为空
+	declared     map[string]bool // 合并后 manifest 中声明的字段
+	refs         map[string]bool // 被引用的变量
+	partials     map[string]bool // 可用的 partial 名称
+	calls        []templateCall  // {{template "名称"}} 引用，所有 partial 收集完成后检查
+	inPartial    bool            // 正在检查 partial 文件
+	issues       []LintIssue
+}
+
+type templateCall struct {
+	name      string
+	file      string
+	line, col int
+}
+
+func (l *linter) add(severity, rule, file string, line, col int, message string) {
+	l.issues = append(l.issues, LintIssue{Severity: severity, Rule: rule, File: file, Line: line, Col: col, Message: message})
+}
+
+func (l *linter) sorted() []LintIssue {
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		a, b := l.issues[i], l.issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return l.issues
+}
+
+// display 返回文件相对模板目录的路径（使用 / 分隔）。
+func (l *linter) display(p string) string {
+	rel, err := filepath.Rel(l.root, p)
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
+
+// checkManifestSchema 严格解析模板自身的 manifest：未知字段报告为警告，类型错误和语法错误报告为错误。
+// 返回解析出的 manifest（没有 manifest 文件时为空 manifest），ok 为 false 表示 manifest 无法加载，无法继续检查。
+func (l *linter) checkManifestSchema() (*Manifest, bool) {
+	var found []string
+	for _, name := range manifestFilenames {
+		if _, err := os.Stat(filepath.Join(l.root, name)); err == nil {
+			found = append(found, name)
+		}
+	}
+	if len(found) == 0 {
+		return &Manifest{}, true
+	}
+	l.manifestFile = found[0]
+	for _, name := range found[1:] {
+		l.add(LintWarning, "manifest", name, 0, 0, fmt.Sprintf("同时存在多个 manifest，只会使用 %s", found[0]))
+	}
+
+	data, err := os.ReadFile(filepath.Join(l.root, l.manifestFile))
+	if err != nil {
+		l.add(LintError, "unreadable", l.manifestFile, 0, 0, err.Error())
+		return nil, false
+	}
+	manifest := &Manifest{}
+	ok := true
+	if strings.HasSuffix(l.manifestFile, ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(manifest); err != nil && !errors.Is(err, io.EOF) {
+			if field, unknown := strings.CutPrefix(err.Error(), "json: unknown field "); unknown {
+				l.add(LintWarning, "manifest", l.manifestFile, 0, 0, fmt.Sprintf("未知的配置项 %s", field))
+				// 忽略未知字段重新解析，继续检查其余内容
+				manifest = &Manifest{}
+				err = json.Unmarshal(data, manifest)
+			}
+			if err != nil {
+				l.add(LintError, "manifest", l.manifestFile, 0, 0, err.Error())
+				ok = false
+			}
+		}
+		return manifest, ok
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(manifest)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil || errors.Is(err, io.EOF):
+	case errors.As(err, &typeErr):
+		// KnownFields 下未知字段也以 TypeError 报告，形如 "line 3: field foo not found in type templates.Field"
+		for _, msg := range typeErr.Errors {
+			line := 0
+			if rest, found := strings.CutPrefix(msg, "line "); found {
+				if n, after, found := strings.Cut(rest, ": "); found {
+					line, _ = strconv.Atoi(n)
+					msg = after
+				}
+			}
+			if field, _, unknown := strings.Cut(strings.TrimPrefix(msg, "field "), " not found in type"); unknown && strings.HasPrefix(msg, "field ") {
+				l.add(LintWarning, "manifest", l.manifestFile, line, 0, fmt.Sprintf("未知的配置项 %s", field))
+				continue
+			}
+			l.add(LintError, "manifest", l.manifestFile, line, 0, msg)
+			ok = false
+		}
+	default:
+		// 语法错误形如 "yaml: line 10: mapping values are not allowed in this context"
+		line, msg := 0, err.Error()
+		if rest, found := strings.CutPrefix(msg, "yaml: line "); found {
+			if n, after, found := strings.Cut(rest, ": "); found {
+				if line, err = strconv.Atoi(n); err == nil {
+					msg = after
+				}
+			}
+		}
+		l.add(LintError, "manifest", l.manifestFile, line, 0, msg)
+		ok = false
+	}
+	return manifest, ok
+}
+
+// checkFields 检查模板自身声明的字段：名称、类型、默认值和计算表达式，以及计算字段之间的循环依赖。
+func (l *linter) checkFields(own, merged *Manifest) {
+	file := l.manifestFile
+	seen := map[string]bool{}
+	exprOK := true
+	for i, f := range own.Fields {
+		switch {
+		case f.Name == "":
+			l.add(LintError, "manifest", file, 0, 0, fmt.Sprintf("第 %d 个字段缺少 name", i+1))
+			continue
+		case seen[f.Name]:
+			l.add(LintError, "manifest", file, 0, 0, fmt.Sprintf("字段 %s 重复声明", f.Name))
+		case !identPattern.MatchString(f.Name):
+			l.add(LintError, "manifest", file, 0, 0, fmt.Sprintf("字段名 %s 不是合法的标识符，无法在模板中引用", f.Name))
+		case helperFuncs[f.Name] != nil || templateBuiltinFuncs[f.Name]:
+			l.add(LintWarning, "manifest", file, 0, 0, fmt.Sprintf("字段 %s 与模板函数同名，会遮蔽该函数", f.Name))
+		}
+		seen[f.Name] = true
+
+		switch f.Type {
+		case "", FieldTypeString, FieldTypeList, FieldTypeObject:
+		default:
+			l.add(LintError, "manifest", file, 0, 0, fmt.Sprintf("字段 %s 的类型 %q 无效，可选 string、list、object", f.Name, f.Type))
+		}
+
+		if f.Computed() {
+			if f.Required {
+				l.add(LintWarning, "manifest", file, 0, 0, fmt.Sprintf("计算字段 %s 的 required 不会生效", f.Name))
+			}
+			if f.Default != "" {
+				l.add(LintWarning, "manifest", file, 0, 0, fmt.Sprintf("计算字段 %s 的 default 不会生效", f.Name))
+			}
+			if !l.checkExpr(f.Value, fmt.Sprintf("计算字段 %s 的表达式", f.Name)) {
+				exprOK = false
+			}
+		}
+		if strings.Contains(f.Default, "{{") {
+			l.checkExpr(f.Default, fmt.Sprintf("字段 %s 的默认值", f.Name))
+		} else if _, err := parseFieldValue(f, f.Default); err != nil {
+			l.add(LintError, "manifest", file, 0, 0, fmt.Sprintf("字段 %s 的默认值无效: %v", f.Name, err))
+		}
+	}
+
+	if exprOK {
+		if _, err := computeOrder(merged); err != nil {
+			l.add(LintError, "manifest", file, 0, 0, err.Error())
+		}
+	}
+}
+
+// checkChecks 检查模板自身 manifest 中的渲染后检查。
+func (l *linter) checkChecks(own *Manifest) {
+	for _, c := range own.Checks {
+		if _, err := c.validate(); err != nil {
+			l.add(LintError, "manifest", l.manifestFile, 0, 0, err.Error())
+			continue
+		}
+		if c.Run != "" {
+			if l.checkExpr(c.Run, fmt.Sprintf("检查 %q 的命令", c.Label())) {
+				if err := checkCommandQuotes(c.Run); err != nil {
+					l.add(LintError, "manifest", l.manifestFile, 0, 0, fmt.Sprintf("检查 %q 的命令无效: %v", c.Label(), err))
+				}
+			}
+		} else {
+			l.checkExpr(c.Exists, fmt.Sprintf("检查 %q 的路径", c.Label()))
+		}
+	}
+}
+
+// checkExpr 解析默认值或计算字段表达式，记录其中引用的变量；表达式无效时返回 false。
+func (l *linter) checkExpr(expr, what string) bool {
+	refs, err := templateRefs(expr)
+	if err != nil {
+		l.add(LintError, "manifest", l.manifestFile, 0, 0, fmt.Sprintf("%s无效: %v", what, err))
+		return false
+	}
+	for _, ref := range refs {
+		l.refs[ref] = true
+		if !l.known(ref) {
+			l.add(LintError, "undeclared", l.manifestFile, 0, 0, fmt.Sprintf("%s引用了未声明的变量 %s", what, ref))
+		}
+	}
+	return true
+}
+
+// checkFanout 检查模板自身 manifest 中的 fan-out 规则。
+func (l *linter) checkFanout(own *Manifest, sources []sourceEntry) {
+	file := l.manifestFile
+	fields := map[string]Field{}
+	for _, f := range own.Fields {
+		fields[f.Name] = f
+	}
+	for _, rule := range own.Fanout {
+		switch {
+		case rule.Each == "":
+			l.add(LintError, "fanout", file, 0, 0, fmt.Sprintf("fan-out 规则 %q 缺少 each", rule.Files))
+		case !l.declared[rule.Each]:
+			l.add(LintError, "fanout", file, 0, 0, fmt.Sprintf("fan-out 变量 %s 未声明", rule.Each))
+		case fields[rule.Each].Type != "" && fields[rule.Each].Type != FieldTypeList:
+			l.add(LintWarning, "fanout", file, 0, 0, fmt.Sprintf("fan-out 变量 %s 不是 list 类型", rule.Each))
+		}
+		l.refs[rule.Each] = true
+
+		if rule.Files == "" {
+			l.add(LintError, "fanout", file, 0, 0, "fan-out 规则缺少 files")
+		} else if _, err := path.Match(rule.Files, ""); err != nil {
+			l.add(LintError, "fanout", file, 0, 0, fmt.Sprintf("fan-out 规则 %q 无效: %v", rule.Files, err))
+		} else {
+			matched := false
+			for _, src := range sources {
+				if ok, _ := path.Match(rule.Files, filepath.ToSlash(src.rel)); ok && !src.dir {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				l.add(LintWarning, "fanout", file, 0, 0, fmt.Sprintf("fan-out 规则 %q 没有匹配任何文件", rule.Files))
+			}
+		}
+
+		if rule.Path != "" {
+			if _, err := l.parse(file, rule.Path, false, true); err == nil {
+				l.checkPathSegments(file, rule.Path, false)
+			}
+		}
+	}
+}
+
+// checkPartials 解析所有 partial 目录，记录可用的 partial 名称；模板自身 _partials/ 中的文件会报告语法错误等问题。
+func (l *linter) checkPartials(dirs []string) error {
+	ownDir := filepath.Join(l.root, PartialsDir)
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(p string, entry os.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			l.partials[strings.TrimSuffix(rel, filepath.Ext(rel))] = true
+			if dir == ownDir {
+				if data, ok := l.readSource(p, true); ok {
+					// partial 通常以 {{template "名称" .}} 调用，其中的 {{.Name}} 计入变量的使用，但不报告未声明
+					l.inPartial = true
+					l.parse(l.display(p), string(data), true, true)
+					l.inPartial = false
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSource 检查单个源文件或目录的路径和内容。
+func (l *linter) checkSource(src sourceEntry, ownDir string, opts RenderOptions) {
+	own := strings.HasPrefix(src.path, ownDir+string(filepath.Separator))
+	file := l.display(src.path)
+
+	rel := filepath.ToSlash(src.rel)
+	fanout, err := opts.fanoutFor(rel)
+	if err != nil {
+		if own {
+			l.add(LintError, "fanout", file, 0, 0, err.Error())
+		}
+		return
+	}
+	// fan-out 文件的 dot 是列表元素，其他文件的 dot 是全部变量
+	dotIsValues := fanout == nil
+	if fanout != nil {
+		l.refs[fanout.Each] = true
+		if own && !l.declared[fanout.Each] {
+			l.add(LintError, "fanout", file, 0, 0, fmt.Sprintf("fan-out 变量 %s 未声明", fanout.Each))
+		}
+	}
+
+	pathText := fanoutMarker.ReplaceAllString(rel, "")
+	if _, err := l.parse(file, pathText, dotIsValues, own); err == nil && own {
+		// 上级目录本身也是源条目，只需检查最后一级
+		l.checkPathSegments(file, pathText, true)
+	}
+	if src.dir {
+		return
+	}
+	// 符号链接不跟随，链接目标按路径模板检查
+	if src.link {
+		target, err := os.Readlink(src.path)
+		if err != nil {
+			if own {
+				l.add(LintError, "unreadable", file, 0, 0, fmt.Sprintf("无法读取符号链接: %v", err))
+			}
+			return
+		}
+		target = filepath.ToSlash(target)
+		if _, err := l.parse(file, target, dotIsValues, own); err == nil && own && !strings.Contains(target, "{{") {
+			if err := checkLinkTarget(filepath.FromSlash(pathText), filepath.FromSlash(target)); err != nil {
+				l.add(LintError, "path", file, 0, 0, err.Error())
+			}
+		}
+		return
+	}
+	if data, ok := l.readSource(src.path, own); ok {
+		l.parse(file, string(data), dotIsValues, own)
+	}
+}
+
+// readSource 读取会被当作模板解析的文件，不可读或为二进制文件时返回 false。
+func (l *linter) readSource(p string, own bool) ([]byte, bool) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if own {
+			l.add(LintError, "unreadable", l.display(p), 0, 0, fmt.Sprintf("无法读取文件: %v", err))
+		}
+		return nil, false
+	}
+	if isBinary(data) {
+		if own {
+			l.add(LintWarning, "binary", l.display(p), 0, 0, "二进制文件会被当作模板解析，内容可能被破坏或导致渲染失败")
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+// checkPathSegments 检查路径模板是否可能渲染为 .. 或绝对路径。
+// 完全由变量组成的片段在变量取值为 .. 或以 / 开头时会逃逸目标目录；经过 kebab 等函数处理的变量是安全的。
+// lastOnly 为 true 时只检查最后一级片段。
+func (l *linter) checkPathSegments(file, pathText string, lastOnly bool) {
+	if strings.HasPrefix(pathText, "/") {
+		l.add(LintError, "path", file, 0, 0, fmt.Sprintf("路径 %s 是绝对路径", pathText))
+		return
+	}
+	segments := strings.Split(pathText, "/")
+	if lastOnly {
+		segments = segments[len(segments)-1:]
+	}
+	for _, seg := range segments {
+		if seg == ".." {
+			l.add(LintError, "path", file, 0, 0, fmt.Sprintf("路径 %s 包含 ..", pathText))
+			return
+		}
+		if !strings.HasPrefix(seg, "{{") || !strings.HasSuffix(seg, "}}") || strings.Count(seg, "{{") != 1 {
+			continue
+		}
+		safe := false
+		for _, word := range wordPattern.FindAllString(seg, -1) {
+			if pathSafeFuncs[word] {
+				safe = true
+			}
+		}
+		if !safe {
+			l.add(LintWarning, "path", file, 0, 0, fmt.Sprintf(
+				"路径片段 %s 完全由变量决定，取值为 .. 或以 / 开头时会被拒绝渲染，可使用 kebab、snake 等函数规范化", seg))
+		}
+	}
+}
+
+// parse 解析模板文本并检查其中引用的变量、函数和 partial。own 为 false 时只记录引用，不报告问题。
+func (l *linter) parse(file, text string, dotIsValues, own bool) (map[string]*parse.Tree, error) {
+	trees := map[string]*parse.Tree{}
+	tree := parse.New(file)
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", trees); err != nil {
+		if own {
+			line, msg := parseErrorLine(file, err)
+			l.add(LintError, "syntax", file, line, actionColumn(sourceLine(text, line)), msg)
+		}
+		return nil, err
+	}
+	for name, t := range trees {
+		// {{define}} 定义的模板在本文件中可以直接引用，其中的 dot 由调用方决定
+		w := &treeWalker{linter: l, tree: t, file: file, own: own, defined: trees}
+		w.walk(t.Root, dotIsValues && name == file)
+	}
+	return trees, nil
+}
+
+// parseErrorLine 从 "template: 名称:行号: 信息" 形式的解析错误中取出行号和信息。
+func parseErrorLine(name string, err error) (int, string) {
+	msg := err.Error()
+	rest, ok := strings.CutPrefix(msg, "template: "+name+":")
+	if !ok {
+		return 0, msg
+	}
+	n, after, ok := strings.Cut(rest, ":")
+	line, convErr := strconv.Atoi(n)
+	if !ok || convErr != nil {
+		return 0, msg
+	}
+	return line, strings.TrimSpace(after)
+}
+
+// known 判断名称是否为已声明的字段、内置变量或模板函数。
+func (l *linter) known(name string) bool {
+	return l.declared[name] || IsBuiltin(name) || helperFuncs[name] != nil || templateBuiltinFuncs[name]
+}
+
+// checkTemplateCalls 检查 {{template "名称"}} 引用的 partial 是否存在。
+func (l *linter) checkTemplateCalls() {
+	for _, c := range l.calls {
+		if !l.partials[c.name] {
+			l.add(LintError, "partial", c.file, c.line, c.col, fmt.Sprintf("引用的 partial %q 不存在", c.name))
+		}
+	}
+}
+
+// treeWalker 遍历解析树，记录引用的变量并报告未声明的变量。
+type treeWalker struct {
+	*linter
+	tree    *parse.Tree
+	file    string
+	own     bool
+	defined map[string]*parse.Tree // 本文件中 {{define}} 的模板
+}
+
+// pos 返回节点的行列号。
+func (w *treeWalker) pos(node parse.Node) (int, int) {
+	loc, _ := w.tree.ErrorContext(node)
+	parts := strings.Split(strings.TrimPrefix(loc, w.file+":"), ":")
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(parts[0])
+	col, _ := strconv.Atoi(parts[1])
+	// ErrorContext 的列号从 0 开始
+	return line, col + 1
+}
+
+func (w *treeWalker) ref(node parse.Node, name string) {
+	w.refs[name] = true
+	if w.own && !w.known(name) {
+		line, col := w.pos(node)
+		w.add(LintError, "undeclared", w.file, line, col, fmt.Sprintf("%s 未在 manifest 中声明，也不是内置变量或函数", name))
+	}
+}
+
+// walk 遍历节点；dotIsValues 表示此处的 dot 是全部变量，{{.Name}} 也视为引用变量 Name。
+func (w *treeWalker) walk(node parse.Node, dotIsValues bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			w.walk(c, dotIsValues)
+		}
+	case *parse.ActionNode:
+		w.walk(n.Pipe, dotIsValues)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			w.walk(c, dotIsValues)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			w.walk(arg, dotIsValues)
+		}
+	case *parse.IdentifierNode:
+		w.ref(n, n.Ident)
+	case *parse.FieldNode:
+		switch {
+		case dotIsValues && w.inPartial:
+			w.refs[n.Ident[0]] = true
+		case dotIsValues:
+			w.ref(n, n.Ident[0])
+		}
+	case *parse.ChainNode:
+		w.walk(n.Node, dotIsValues)
+	case *parse.IfNode:
+		w.walk(n.Pipe, dotIsValues)
+		w.walk(n.List, dotIsValues)
+		w.walk(n.ElseList, dotIsValues)
+	case *parse.RangeNode:
+		// range/with 的主体中 dot 是当前元素，else 分支中 dot 不变
+		w.walk(n.Pipe, dotIsValues)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, dotIsValues)
+	case *parse.WithNode:
+		w.walk(n.Pipe, dotIsValues)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, dotIsValues)
+	case *parse.TemplateNode:
+		w.walk(n.Pipe, dotIsValues)
+		if _, ok := w.defined[n.Name]; !ok && w.own {
+			line, col := w.pos(n)
+			w.calls = append(w.calls, templateCall{name: n.Name, file: w.file, line: line, col: col})
+		}
+	}
+}
+
+// isBinary 判断内容是否为二进制：包含 NUL 字节或不是合法的 UTF-8。
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
@@ -1,7 +1,6 @@
 package templates
 
 import (
-	"archive/zip"
 	"fmt"
 	"io"
 	"io/fs"
@@ -22,8 +21,17 @@ type Manager struct {
 
 // TemplateInfo 描述一个模板的基本信息。
 type TemplateInfo struct {
-	Name        string // 模板名称
-	Description string // 模板描述（来自 manifest）
+	Name        string             // 模板名称
+	Description string             // 模板描述（来自 manifest）
+	Source      string             // 模板来源（project、env、user、system）
+	Path        string             // 模板目录
+	Shadowed    []ShadowedTemplate `json:",omitempty"` // 被该模板遮蔽的低优先级同名模板
+}
+
+// ShadowedTemplate 描述搜索路径中被遮蔽的同名模板。
+type ShadowedTemplate struct {
+	Source string
+	Path   string
 }
 
 // NewManager 创建模板管理器。
@@ -43,8 +51,9 @@ func (m *Manager) Add(name, from string, force bool) error {
 		return err
 	}
 	dst := filepath.Join(m.paths.TemplatesDir, name)
-	
+
 	// 如果模板已存在，处理备份或返回错误
+	backedUp := false
 	if _, err := os.Stat(dst); err == nil {
 		if !force {
 			return fmt.Errorf("模板 %s 已存在，使用 --force 覆盖", name)
@@ -53,84 +62,141 @@ func (m *Manager) Add(name, from string, force bool) error {
 		if err := m.backupTemplate(name); err != nil {
 			return fmt.Errorf("备份模板失败: %w", err)
 		}
+		backedUp = true
 	}
-	
+
 	// 清理目标目录
 	if err := os.RemoveAll(dst); err != nil {
 		return fmt.Errorf("清理旧模板失败: %w", err)
 	}
-	
-	// 复制模板
+
+	// 复制模板，失败时不留下不完整的副本
 	if err := copyDir(from, dst); err != nil {
+		os.RemoveAll(dst)
+		if backedUp {
+			if backupErr := m.restoreTemplate(name); backupErr != nil {
+				return fmt.Errorf("%w，且恢复备份失败: %v", err, backupErr)
+			}
+		}
 		return err
 	}
-	
-	// 验证模板有效性
-	if err := m.Validate(name); err != nil {
+
+	// 验证模板有效性（直接检查用户目录中的副本，避免被其他来源的同名模板遮蔽）
+	if err := validateTemplateDir(dst); err != nil {
 		// 如果验证失败，尝试恢复备份
 		if backupErr := m.restoreTemplate(name); backupErr != nil {
 			return fmt.Errorf("模板验证失败: %w，且恢复备份失败: %v", err, backupErr)
 		}
 		return fmt.Errorf("模板验证失败: %w，已恢复备份", err)
 	}
-	
+
 	return nil
 }
 
-// Remove 删除模板。
+// Remove 删除模板。只能删除用户模板目录中的模板，其他来源的模板需要手动管理。
 func (m *Manager) Remove(name string) error {
 	if err := validateTemplateName(name); err != nil {
 		return err
 	}
-	return os.RemoveAll(filepath.Join(m.paths.TemplatesDir, name))
+	dst := filepath.Join(m.paths.TemplatesDir, name)
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		if src, path, ok := m.lookup(name); ok {
+			return fmt.Errorf("模板 %s 来自 %s 目录 %s，kuai 只能删除用户模板目录中的模板", name, src, path)
+		}
+	}
+	return os.RemoveAll(dst)
 }
 
-// List 返回模板信息。
+// List 按搜索路径返回模板信息。
+// 同名模板以优先级最高的来源为准，低优先级的副本记录在 Shadowed 中。
 func (m *Manager) List() ([]TemplateInfo, error) {
-	entries, err := os.ReadDir(m.paths.TemplatesDir)
-	if err != nil {
-		return nil, err
-	}
+	index := map[string]int{}
 	var infos []TemplateInfo
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+	for _, src := range m.searchPath() {
+		entries, err := os.ReadDir(src.Dir)
+		if err != nil {
+			// 搜索路径中除用户目录外都是可选的
+			if os.IsNotExist(err) && src.Name != config.SourceUser {
+				continue
+			}
+			return nil, err
 		}
-		name := entry.Name()
-		desc := ""
-		if manifest, _, _ := LoadManifest(filepath.Join(m.paths.TemplatesDir, name)); manifest != nil {
-			desc = manifest.Description
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			name := entry.Name()
+			path := filepath.Join(src.Dir, name)
+			if i, ok := index[name]; ok {
+				infos[i].Shadowed = append(infos[i].Shadowed, ShadowedTemplate{Source: src.Name, Path: path})
+				continue
+			}
+			desc := ""
+			if manifest, _, _ := LoadManifest(path); manifest != nil {
+				desc = manifest.Description
+			}
+			index[name] = len(infos)
+			infos = append(infos, TemplateInfo{
+				Name:        name,
+				Description: desc,
+				Source:      src.Name,
+				Path:        path,
+			})
 		}
-		infos = append(infos, TemplateInfo{
-			Name:        name,
-			Description: desc,
-		})
 	}
 	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
 	return infos, nil
 }
 
-// TemplatePath 返回模板目录。
+// TemplatePath 按搜索路径查找模板目录，返回优先级最高的一个。
 func (m *Manager) TemplatePath(name string) (string, error) {
 	// 验证模板名称：防止路径遍历和特殊字符
 	if err := validateTemplateName(name); err != nil {
 		return "", err
 	}
-	path := filepath.Join(m.paths.TemplatesDir, name)
-	if stat, err := os.Stat(path); err != nil || !stat.IsDir() {
+	_, path, ok := m.lookup(name)
+	if !ok {
 		return "", fmt.Errorf("模板 %s 不存在", name)
 	}
 	return path, nil
 }
 
+// lookup 在搜索路径中查找模板，返回来源名称和目录。
+func (m *Manager) lookup(name string) (string, string, bool) {
+	for _, src := range m.searchPath() {
+		path := filepath.Join(src.Dir, name)
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			return src.Name, path, true
+		}
+	}
+	return "", "", false
+}
+
+// searchPath 返回模板搜索路径，未配置时只包含用户模板目录。
+func (m *Manager) searchPath() []config.TemplateSource {
+	if len(m.paths.SearchPath) > 0 {
+		return m.paths.SearchPath
+	}
+	return []config.TemplateSource{{Name: config.SourceUser, Dir: m.paths.TemplatesDir}}
+}
+
 // Validate 验证模板是否有效。
-// 检查模板目录是否存在，是否包含必要的文件。
+// 检查模板目录是否存在，是否包含必要的文件，以及 extends/include 能否展开。
 func (m *Manager) Validate(name string) error {
 	path, err := m.TemplatePath(name)
 	if err != nil {
 		return err
 	}
-	
+	if err := validateTemplateDir(path); err != nil {
+		return err
+	}
+	// extends/include 引用的模板必须存在且不能循环
+	_, err = m.Resolve(name)
+	return err
+}
+
+// validateTemplateDir 检查模板目录是否包含必要的文件。
+func validateTemplateDir(path string) error {
 	// 检查目录是否为空
 	entries, err := os.ReadDir(path)
 	if err != nil {
@@ -139,7 +205,7 @@ func (m *Manager) Validate(name string) error {
 	if len(entries) == 0 {
 		return fmt.Errorf("模板目录为空")
 	}
-	
+
 	// 检查是否有 template/ 子目录或直接包含模板文件
 	hasTemplateDir := false
 	hasFiles := false
@@ -147,124 +213,63 @@ func (m *Manager) Validate(name string) error {
 		if entry.IsDir() && entry.Name() == "template" {
 			hasTemplateDir = true
 		}
-		if !entry.IsDir() && entry.Name() != "kuai.yaml" && entry.Name() != "kuai.yml" && entry.Name() != "kuai.json" {
+		if _, isManifest := skipFiles[strings.ToLower(entry.Name())]; !isManifest && entry.Name() != ".git" {
 			hasFiles = true
 		}
 	}
-	
+
 	if !hasTemplateDir && !hasFiles {
-		return fmt.Errorf("模板不包含任何文件")
+		// 只组合其他模板的模板可以没有自己的文件
+		manifest, manifestPath, err := LoadManifest(path)
+		if err != nil {
+			return err
+		}
+		if manifestPath == "" || (manifest.Extends == "" && len(manifest.Include) == 0) {
+			return fmt.Errorf("模板不包含任何文件")
+		}
 	}
-	
+
 	return nil
 }
 
-// Export 将模板导出为 ZIP 文件。
+// Export 将模板导出为 ZIP 文件，保留文件权限和符号链接。
 func (m *Manager) Export(name, outputPath string) error {
 	path, err := m.TemplatePath(name)
 	if err != nil {
 		return err
 	}
-	
-	// 创建 ZIP 文件
-	zipFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("创建 ZIP 文件失败: %w", err)
-	}
-	defer zipFile.Close()
-	
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
-	
-	// 遍历模板目录并添加到 ZIP
-	return filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		// 跳过 .git 目录
-		if entry.IsDir() && entry.Name() == ".git" {
-			return filepath.SkipDir
-		}
-		
-		// 计算相对路径
-		relPath, err := filepath.Rel(path, filePath)
-		if err != nil {
-			return err
-		}
-		
-		// 跳过根目录本身
-		if relPath == "." {
-			return nil
-		}
-		
-		info, err := entry.Info()
-		if err != nil {
-			return err
-		}
-		
-		// 创建 ZIP 文件头
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
-		header.Name = relPath
-		if entry.IsDir() {
-			header.Name += "/"
-		}
-		
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return err
-		}
-		
-		// 如果是文件，写入内容
-		if !entry.IsDir() {
-			file, err := os.Open(filePath)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-			
-			_, err = io.Copy(writer, file)
-			if err != nil {
-				return err
-			}
-		}
-		
-		return nil
-	})
+	return ZipDir(path, outputPath)
 }
 
 // backupTemplate 备份现有模板到备份目录。
 func (m *Manager) backupTemplate(name string) error {
 	src := filepath.Join(m.paths.TemplatesDir, name)
-	backupDir := filepath.Join(m.paths.ConfigDir, "backups")
+	backupDir := m.backupDir()
 	if err := os.MkdirAll(backupDir, 0o755); err != nil {
 		return err
 	}
-	
+
 	// 使用时间戳作为备份名称
 	timestamp := time.Now().Format("20060102-150405")
 	backupName := fmt.Sprintf("%s-%s", name, timestamp)
 	backupPath := filepath.Join(backupDir, backupName)
-	
+
 	return copyDir(src, backupPath)
 }
 
 // restoreTemplate 从最近的备份恢复模板。
 func (m *Manager) restoreTemplate(name string) error {
-	backupDir := filepath.Join(m.paths.ConfigDir, "backups")
+	backupDir := m.backupDir()
 	entries, err := os.ReadDir(backupDir)
 	if err != nil {
 		return fmt.Errorf("读取备份目录失败: %w", err)
 	}
-	
+
 	// 查找匹配的备份（以模板名开头）
 	var latestBackup string
 	var latestTime time.Time
 	prefix := name + "-"
-	
+
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -272,7 +277,7 @@ func (m *Manager) restoreTemplate(name string) error {
 		if !strings.HasPrefix(entry.Name(), prefix) {
 			continue
 		}
-		
+
 		// 尝试解析时间戳
 		timestampStr := strings.TrimPrefix(entry.Name(), prefix)
 		if t, err := time.Parse("20060102-150405", timestampStr); err == nil {
@@ -282,23 +287,32 @@ func (m *Manager) restoreTemplate(name string) error {
 			}
 		}
 	}
-	
+
 	if latestBackup == "" {
 		return fmt.Errorf("未找到备份")
 	}
-	
+
 	backupPath := filepath.Join(backupDir, latestBackup)
 	dst := filepath.Join(m.paths.TemplatesDir, name)
-	
+
 	// 清理目标目录
 	if err := os.RemoveAll(dst); err != nil {
 		return err
 	}
-	
+
 	// 恢复备份
 	return copyDir(backupPath, dst)
 }
 
+// backupDir 返回模板备份目录，位于数据目录下。
+func (m *Manager) backupDir() string {
+	dataDir := m.paths.DataDir
+	if dataDir == "" {
+		dataDir = m.paths.ConfigDir
+	}
+	return filepath.Join(dataDir, "backups")
+}
+
 // validateTemplateName 验证模板名称是否合法。
 func validateTemplateName(name string) error {
 	if name == "" {
@@ -321,7 +335,7 @@ func copyDir(src, dst string) error {
 	if err := os.MkdirAll(dst, info.Mode()); err != nil {
 		return fmt.Errorf("创建目标目录失败: %w", err)
 	}
-	// 使用 WalkDir 提升性能（不需要读取文件信息）
+	// 使用 WalkDir 提升性能（不需要读取文件信息），WalkDir 不会跟随符号链接
 	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -337,9 +351,23 @@ func copyDir(src, dst string) error {
 		if err != nil {
 			return err
 		}
+		if err := checkNoSymlink(dst, rel); err != nil {
+			return err
+		}
 		if entry.IsDir() {
 			return os.MkdirAll(filepath.Join(dst, rel), info.Mode())
 		}
+		// 符号链接按链接复制，不跟随；指向目录之外的链接会被拒绝
+		if entry.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := checkLinkTarget(rel, target); err != nil {
+				return err
+			}
+			return os.Symlink(target, filepath.Join(dst, rel))
+		}
 		return copyFile(path, filepath.Join(dst, rel), info.Mode())
 	})
 }
@@ -365,4 +393,3 @@ func copyFile(src, dst string, mode os.FileMode) error {
 	}
 	return nil
 }
-
@@ -24,10 +24,18 @@ var skipFiles = map[string]struct{}{
 
 // Manifest 描述模板所需的变量。
 type Manifest struct {
-	Name        string        `json:"name" yaml:"name"`
-	Description string        `json:"description" yaml:"description"`
-	Fields      []Field       `json:"fields" yaml:"fields"`
-	Meta        ManifestMeta  `json:"meta" yaml:"meta"`
+	Name        string       `json:"name" yaml:"name"`
+	Description string       `json:"description" yaml:"description"`
+	Fields      []Field      `json:"fields" yaml:"fields"`
+	Fanout      []FanoutRule `json:"fanout,omitempty" yaml:"fanout,omitempty"` // 按列表变量重复渲染文件的规则
+	Meta        ManifestMeta `json:"meta" yaml:"meta"`
+	Extends     string       `json:"extends,omitempty" yaml:"extends,omitempty"`       // 继承的父模板
+	Include     []string     `json:"include,omitempty" yaml:"include,omitempty"`       // 组合进来的其他模板
+	Checks      []Check      `json:"checks,omitempty" yaml:"checks,omitempty"`         // 渲染后对生成结果的检查
+	Format      []FormatRule `json:"format,omitempty" yaml:"format,omitempty"`         // 生成文件的格式化规则（可选）
+	TrimBlocks  *bool        `json:"trimBlocks,omitempty" yaml:"trimBlocks,omitempty"` // 去掉控制结构所在行渲染后留下的空行，未设置时继承父模板
+	EOL         []EOLRule    `json:"eol,omitempty" yaml:"eol,omitempty"`               // 生成文件的换行符规则
+	Modes       []ModeRule   `json:"modes,omitempty" yaml:"modes,omitempty"`           // 覆盖生成文件的权限
 }
 
 // ManifestMeta 存储额外信息。
@@ -40,8 +48,13 @@ type Field struct {
 	Name        string `json:"name" yaml:"name"`
 	Prompt      string `json:"prompt" yaml:"prompt"`
 	Description string `json:"description" yaml:"description"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"` // string（默认）、list 或 object
 	Default     string `json:"default" yaml:"default"`
 	Required    bool   `json:"required" yaml:"required"`
+	Secret      bool   `json:"secret,omitempty" yaml:"secret,omitempty"` // 敏感字段，审计日志中会被掩码
+	// Value 是计算字段的模板表达式，如 "{{RepoBase}}/{{RepoGroup}}/{{Name}}"。
+	// 计算字段不会提示输入，在其他变量收集完成后按依赖顺序计算，也可以通过 --var 等方式覆盖。
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
 }
 
 // LoadManifest 读取模板 Manifest。如果没有找到，会自动扫描模板变量生成默认配置。
@@ -72,6 +85,20 @@ func LoadManifest(dir string) (*Manifest, string, error) {
 	return manifest, "", nil
 }
 
+// SecretFields 返回标记为 secret 的字段集合。
+func (m *Manifest) SecretFields() map[string]bool {
+	secret := map[string]bool{}
+	if m == nil {
+		return secret
+	}
+	for _, f := range m.Fields {
+		if f.Secret {
+			secret[f.Name] = true
+		}
+	}
+	return secret
+}
+
 // ScanTemplateVariables 扫描模板目录中的所有 {{变量名}}，生成默认 Manifest。
 func ScanTemplateVariables(dir string) *Manifest {
 	varMap := make(map[string]struct{})
@@ -119,8 +146,8 @@ func ScanTemplateVariables(dir string) *Manifest {
 	// 转换为排序后的字段列表
 	var names []string
 	for name := range varMap {
-		// 排除一些常见的系统变量
-		if name != "TemplateName" {
+		// 排除内置变量
+		if !IsBuiltin(name) {
 			names = append(names, name)
 		}
 	}
@@ -0,0 +1,81 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ModeRule 覆盖匹配的生成文件的权限，例如让 scripts/*.sh 可执行。
+// 未匹配规则的文件和目录沿用源文件的权限。
+type ModeRule struct {
+	Files string `json:"files" yaml:"files"` // 目标路径的 glob（同 format）
+	Mode  string `json:"mode" yaml:"mode"`   // 八进制权限，如 "0755"
+}
+
+// parse 校验规则并返回权限。
+func (r ModeRule) parse() (fs.FileMode, error) {
+	if r.Files == "" {
+		return 0, fmt.Errorf("权限规则缺少 files")
+	}
+	if _, err := globRegexp(r.Files); err != nil {
+		return 0, fmt.Errorf("权限规则 %q 无效: %w", r.Files, err)
+	}
+	mode, err := strconv.ParseUint(r.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("权限规则 %q 的 mode %q 无效，需要八进制权限如 0755", r.Files, r.Mode)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// fileMode 返回生成文件的权限：第一条匹配 rel（使用 / 分隔的目标路径）的规则优先，否则使用源文件的权限。
+func (o RenderOptions) fileMode(rel string, source fs.FileMode) (fs.FileMode, error) {
+	for _, rule := range o.Modes {
+		matched, err := matchGlob(rule.Files, rel)
+		if err != nil {
+			return 0, fmt.Errorf("权限规则 %q 无效: %w", rule.Files, err)
+		}
+		if matched {
+			return rule.parse()
+		}
+	}
+	return source.Perm(), nil
+}
+
+// checkNoSymlink 检查 rel（相对 root）经过的每一级已存在的路径都不是符号链接。
+// checkLinkTarget 只按文本检查单个链接，多个链接串联（如 a/up -> .. 之后再写 a/up/z -> ../../x）仍可能逃逸出 root，
+// 因此写入任何条目前都不允许经过之前创建的符号链接。
+func checkNoSymlink(root, rel string) error {
+	current := root
+	for _, part := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("路径 %s 经过符号链接 %s，拒绝写入", filepath.ToSlash(rel), filepath.ToSlash(strings.TrimPrefix(current, root+string(filepath.Separator))))
+		}
+	}
+	return nil
+}
+
+// checkLinkTarget 检查符号链接的目标：必须是相对路径，且从链接所在目录解析后不能逃逸出根目录。
+// linkRel 是链接相对根目录的路径。
+func checkLinkTarget(linkRel, target string) error {
+	if target == "" || filepath.IsAbs(target) || strings.HasPrefix(filepath.ToSlash(target), "/") {
+		return fmt.Errorf("符号链接 %s 的目标 %q 必须是相对路径", linkRel, target)
+	}
+	resolved := filepath.Clean(filepath.Join(filepath.Dir(linkRel), target))
+	if resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("符号链接 %s 的目标 %q 指向目录之外，拒绝创建", linkRel, target)
+	}
+	return nil
+}
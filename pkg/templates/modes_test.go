@@ -0,0 +1,154 @@
+package templates
+
+import (
+	"archive/zip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinkTarget(t *testing.T) {
+	tests := []struct {
+		link   string
+		target string
+		ok     bool
+	}{
+		{"current", "v1.txt", true},
+		{"bin/tool", "../scripts/tool.sh", true},
+		{"a/b/c", "../../x", true},
+		{"a/link", "sub/../../x", true},
+		{"current", "../outside", false},
+		{"current", "..", false},
+		{"a/link", "../../outside", false},
+		{"a/link", "sub/../../../outside", false},
+		{"current", "/etc/passwd", false},
+		{"current", "", false},
+	}
+	for _, tt := range tests {
+		err := checkLinkTarget(filepath.FromSlash(tt.link), filepath.FromSlash(tt.target))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s -> %q: 错误为 %v，期望允许=%v", tt.link, tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckNoSymlink(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(root, "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir", filepath.Join(root, "dir-link")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rel string
+		ok  bool
+	}{
+		{"dir/file.txt", true},
+		{"missing/deep/file.txt", true},
+		{"up/escape.txt", false},
+		{"dir-link/file.txt", false},
+		{"up", false},
+	}
+	for _, tt := range tests {
+		err := checkNoSymlink(root, filepath.FromSlash(tt.rel))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: 错误为 %v，期望允许=%v", tt.rel, err, tt.ok)
+		}
+	}
+}
+
+// zipEntry 是测试 ZIP 中的一个条目，link 非空时为符号链接。
+type zipEntry struct {
+	name string
+	data string
+	link string
+}
+
+func writeTestZip(t *testing.T, entries []zipEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		content := e.data
+		if e.link != "" {
+			header.SetMode(fs.ModeSymlink | 0o777)
+			content = e.link
+		} else {
+			header.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractZipRejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		err     string
+	}{
+		{name: "../ 路径", entries: []zipEntry{{name: "../evil.txt", data: "x"}}, err: "指向目录之外"},
+		{name: "嵌套 ../ 路径", entries: []zipEntry{{name: "a/../../evil.txt", data: "x"}}, err: "指向目录之外"},
+		{name: "绝对路径", entries: []zipEntry{{name: "/tmp/evil.txt", data: "x"}}, err: "指向目录之外"},
+		{name: "链接目标为 ../", entries: []zipEntry{{name: "link", link: "../evil"}}, err: "指向目录之外"},
+		{name: "链接目标为绝对路径", entries: []zipEntry{{name: "link", link: "/etc/passwd"}}, err: "必须是相对路径"},
+		{name: "经过链接写入", entries: []zipEntry{
+			{name: "a/up", link: ".."},
+			{name: "a/up/z", link: "../evil"},
+		}, err: "经过符号链接"},
+		{name: "经过链接写入文件", entries: []zipEntry{
+			{name: "dir", link: "."},
+			{name: "dir/evil.txt", data: "x"},
+		}, err: "经过符号链接"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "dest")
+			err := ExtractZip(writeTestZip(t, tt.entries), dest)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("错误为 %v，期望包含 %q", err, tt.err)
+			}
+			if _, err := os.Lstat(filepath.Join(parent, "evil.txt")); err == nil {
+				t.Fatal("文件被写到了解压目录之外")
+			}
+		})
+	}
+}
+
+func TestExtractZipKeepsInternalLinks(t *testing.T) {
+	dest := t.TempDir()
+	err := ExtractZip(writeTestZip(t, []zipEntry{
+		{name: "docs/v1.txt", data: "v1"},
+		{name: "docs/current", link: "v1.txt"},
+		{name: "bin/docs", link: "../docs"},
+	}), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "docs", "current"))
+	if err != nil || string(data) != "v1" {
+		t.Fatalf("docs/current 的内容为 %q（%v），期望 v1", data, err)
+	}
+}
@@ -0,0 +1,72 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// PartialsDir 是模板中存放 partial 的目录名，不会输出到生成的项目中。
+const PartialsDir = "_partials"
+
+// loadPartials 将 partial 目录中的文件注册为命名模板，名称为去掉扩展名的相对路径，
+// 例如 _partials/license.txt 可通过 {{template "license" .}} 引用，_partials/ci/steps.yml 对应 "ci/steps"。
+// 靠后目录中的同名 partial 覆盖靠前的；不存在的目录会被忽略。prepare 在解析前处理文件内容（如去掉控制结构行）。
+// 共享 partial 可能引用当前模板没有的变量，这些变量只在 partial 实际被使用时才报错，funcs 是当前可用的变量和函数。
+// 返回 partial 名称到源文本的映射，用于在错误信息中显示出错位置附近的内容。
+func loadPartials(base *template.Template, dirs []fs.FS, funcs template.FuncMap, prepare func(string) string) (map[string]string, error) {
+	sources := map[string]string{}
+	for _, dir := range dirs {
+		if _, err := fs.Stat(dir, "."); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		err := fs.WalkDir(dir, ".", func(name string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			partial := strings.TrimSuffix(name, path.Ext(name))
+
+			data, err := fs.ReadFile(dir, name)
+			if err != nil {
+				return err
+			}
+			text := prepare(string(data))
+			if refs, err := templateRefs(text); err == nil {
+				missing := template.FuncMap{}
+				for _, ref := range refs {
+					if _, ok := funcs[ref]; !ok && !templateBuiltinFuncs[ref] {
+						missing[ref] = undefinedVar(ref)
+					}
+				}
+				base.Funcs(missing)
+			}
+			if _, err := base.New(partial).Parse(text); err != nil {
+				return fmt.Errorf("解析 partial %s 失败: %w", partialPath(dir, name), err)
+			}
+			sources[partial] = string(data)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// partialPath 返回用于错误信息的 partial 路径：磁盘目录中的 partial 使用完整路径。
+func partialPath(dir fs.FS, name string) string {
+	if p := diskPath(dir, name); p != "" {
+		return p
+	}
+	return path.Join(PartialsDir, name)
+}
+
+// undefinedVar 返回调用时报错的占位函数，用于 partial 中引用的不存在的变量。
+func undefinedVar(name string) func() (any, error) {
+	return func() (any, error) {
+		return nil, fmt.Errorf("变量 %s 不存在", name)
+	}
+}
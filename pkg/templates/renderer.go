@@ -2,99 +2,512 @@ package templates
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/fs"
-	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 )
 
-// Render 将模板渲染到目标目录。
-// 会遍历源目录中的所有文件，使用 values 中的变量替换模板语法 {{变量名}}。
-// 同时支持文件路径和文件内容的模板渲染。
-// 安全性：会自动检查渲染后的路径，防止路径遍历攻击。
-func Render(srcDir, dstDir string, values map[string]string) error {
+// RenderedFile 表示在内存中渲染完成的单个文件或符号链接。
+type RenderedFile struct {
+	Path    string      // 渲染后的相对路径（统一使用 / 分隔）
+	Content []byte      // 渲染后的文件内容，符号链接为空
+	Mode    fs.FileMode // 文件权限
+	Link    string      // 符号链接的目标（已渲染），普通文件为空
+}
+
+// Renderer 从 fs.FS 渲染模板并把结果交给 Sink，可以渲染 go:embed 嵌入的模板，或在测试中使用 fstest.MapFS 渲染到
+// MemorySink 而不接触磁盘。Render、RenderFiles 等函数是渲染磁盘目录的简便写法。
+type Renderer struct {
+	Source fs.FS // 模板根目录
+	// Layers 是优先级低于 Source 的其他模板（如 extends/include 的模板），按优先级从低到高；
+	// 排在 Options.Layers 中的磁盘目录之后。
+	Layers []fs.FS
+	// Partials 是共享 partial 目录，靠后的优先；排在 Options.PartialDirs 之后，Source 中的 _partials/ 优先级最高。
+	Partials []fs.FS
+	Options  RenderOptions
+}
+
+// Render 使用 values 渲染模板，按源文件的顺序把结果写入 sink。
+// 渲染分三步：先按源文件顺序渲染所有目标路径、检查冲突，得到渲染计划；再由最多 Options.Workers 个 worker
+// 并发渲染文件内容；最后按计划的顺序写入 sink。写入顺序和报告的错误与逐个渲染时完全相同，不受并发影响。
+// ctx 取消后不再渲染新的文件，正在运行的外部格式化命令会被终止，返回 ctx.Err()。
+// 出错或取消时，之前已经写入 sink 的文件不会被撤销，见 Sink。
+func (r *Renderer) Render(ctx context.Context, values map[string]any, sink Sink) error {
+	opts := r.Options
 	funcs := buildFuncMap(values)
-	renderPath := func(rel string) (string, error) {
-		tmpl, err := template.New("path").Funcs(funcs).Option("missingkey=error").Parse(rel)
-		if err != nil {
-			return "", err
+	// 同一路径模板（如 fan-out 的目标路径）只解析一次；不含模板语法的路径直接使用
+	pathTemplates := map[string]*template.Template{}
+	execute := func(name, text string, data any) (string, error) {
+		if !strings.Contains(text, "{{") {
+			return text, nil
+		}
+		key := name + "\x00" + text
+		tmpl, ok := pathTemplates[key]
+		if !ok {
+			var err error
+			if tmpl, err = template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text); err != nil {
+				return "", err
+			}
+			pathTemplates[key] = tmpl
 		}
 		var b bytes.Buffer
-		if err := tmpl.Execute(&b, values); err != nil {
+		if err := tmpl.Execute(&b, data); err != nil {
 			return "", err
 		}
 		return b.String(), nil
 	}
-
-	return filepath.WalkDir(srcDir, func(path string, entry fs.DirEntry, err error) error {
+	// 文件内容可以通过 {{template "名称" .}} 引用共享目录和模板 _partials/ 中的 partial
+	base := template.New("").Funcs(funcs).Option("missingkey=error")
+	partialDirs := append(dirFSList(opts.PartialDirs), r.Partials...)
+	if sub, err := fs.Sub(r.Source, PartialsDir); err == nil {
+		partialDirs = append(partialDirs, sub)
+	}
+	partials, err := loadPartials(base, partialDirs, funcs, opts.prepareTemplate)
+	if err != nil {
+		return err
+	}
+	renderContent := func(job *renderJob) {
+		e := func(err error) *RenderError {
+			return &RenderError{Stage: StageFinish, File: job.file, Path: job.target, Message: err.Error(), Err: err}
+		}
+		name := job.src.rel
+		parsed := job.parsed
+		// 源文件在第一次渲染时才读取，计划中不保存文件内容
+		parsed.once.Do(func() {
+			data, err := fs.ReadFile(job.src.fsys, job.src.name)
+			if err != nil {
+				parsed.readErr = err
+				return
+			}
+			parsed.text = string(data)
+			set, err := base.Clone()
+			if err != nil {
+				parsed.err = err
+				return
+			}
+			parsed.tmpl, parsed.err = set.New(name).Parse(opts.prepareTemplate(parsed.text))
+		})
+		if parsed.readErr != nil {
+			job.err = &RenderError{Stage: StageContent, File: job.file, Path: job.target, Message: parsed.readErr.Error(), Err: parsed.readErr}
+			return
+		}
+		err := parsed.err
+		var b bytes.Buffer
+		if err == nil {
+			err = parsed.tmpl.Execute(&b, job.item)
+		}
 		if err != nil {
-			return err
+			job.err = templateError(StageContent, job.file, name, parsed.text, partials, err)
+			job.err.Path = job.target
+			return
+		}
+		if job.content, err = opts.finishContent(ctx, job.target, b.Bytes()); err != nil {
+			job.err = e(err)
+			return
 		}
-		if entry.Name() == ".git" {
-			return filepath.SkipDir
+		if job.mode, err = opts.fileMode(job.target, job.src.mode); err != nil {
+			job.err = e(err)
 		}
+	}
 
-		rel, err := filepath.Rel(srcDir, path)
-		if err != nil {
+	sources, err := collectSources(append(append(dirFSList(opts.Layers), r.Layers...), r.Source), opts.Exclude)
+	if err != nil {
+		return err
+	}
+	plan, err := planRender(ctx, sources, values, opts, execute)
+	if err != nil {
+		return err
+	}
+
+	// worker 并发渲染文件内容；出错停止或 ctx 取消后，尚未开始的文件不再渲染。
+	// worker 最多领先写入 workers*renderAhead 个文件，已渲染但尚未写入的内容不会无限堆积在内存中
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	queue := make(chan *renderJob)
+	ahead := make(chan struct{}, workers*renderAhead)
+	quit := make(chan struct{})
+	var stopped atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if !stopped.Load() && ctx.Err() == nil {
+					renderContent(job)
+				}
+				close(job.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for _, job := range plan {
+			if job.done == nil {
+				continue
+			}
+			select {
+			case ahead <- struct{}{}:
+			case <-quit:
+				return
+			}
+			queue <- job
+		}
+	}()
+	defer func() {
+		stopped.Store(true)
+		close(quit)
+		wg.Wait()
+	}()
+
+	// 按计划的顺序写入；默认在第一个错误处停止，CollectErrors 时记录所有错误
+	var collected RenderErrors
+	for _, job := range plan {
+		if job.done != nil {
+			<-job.done
+			<-ahead
+		}
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		if rel == "." {
-			return nil
+		if job.err != nil {
+			if !opts.CollectErrors {
+				return job.err
+			}
+			collected = append(collected, job.err)
+			continue
+		}
+		switch {
+		case job.src.dir:
+			if err := sink.Mkdir(job.target, job.mode); err != nil {
+				return err
+			}
+		case job.src.link:
+			if err := sink.Symlink(job.target, job.link); err != nil {
+				return err
+			}
+		default:
+			err := sink.WriteFile(job.target, job.content, job.mode)
+			// 写入后释放内容；最后一个引用解析结果的文件写入后，源文件内容和解析结果也可以被回收
+			job.content, job.parsed = nil, nil
+			if err != nil {
+				e := &RenderError{Stage: StageFinish, File: job.file, Path: job.target, Message: err.Error(), Err: err}
+				if !opts.CollectErrors {
+					return e
+				}
+				collected = append(collected, e)
+			}
 		}
+	}
+	if len(collected) > 0 {
+		return collected
+	}
+	return nil
+}
 
-		targetRel, err := renderPath(rel)
-		if err != nil {
-			return fmt.Errorf("渲染路径 %s 失败: %w", rel, err)
+// Render 将模板渲染到目标目录。
+// 会遍历源目录中的所有文件，使用 values 中的变量替换模板语法 {{变量名}}。
+// 同时支持文件路径和文件内容的模板渲染。
+// 安全性：会自动检查渲染后的路径，防止路径遍历攻击。
+func Render(srcDir, dstDir string, values map[string]any) error {
+	return RenderWithOptions(srcDir, dstDir, values, RenderOptions{})
+}
+
+// RenderWithOptions 与 Render 相同，额外应用 manifest 中的渲染选项（如 fan-out 规则）。
+func RenderWithOptions(srcDir, dstDir string, values map[string]any, opts RenderOptions) error {
+	r := &Renderer{Source: DirFS(srcDir), Options: opts}
+	return r.Render(context.Background(), values, DirSink{Root: dstDir})
+}
+
+// RenderFiles 在内存中渲染模板并返回所有文件，不会写入磁盘，适用于预览。
+func RenderFiles(srcDir string, values map[string]any) ([]RenderedFile, error) {
+	return RenderFilesWithOptions(srcDir, values, RenderOptions{})
+}
+
+// RenderFilesWithOptions 与 RenderFiles 相同，额外应用渲染选项。
+func RenderFilesWithOptions(srcDir string, values map[string]any, opts RenderOptions) ([]RenderedFile, error) {
+	sink := &MemorySink{}
+	r := &Renderer{Source: DirFS(srcDir), Options: opts}
+	if err := r.Render(context.Background(), values, sink); err != nil {
+		return nil, err
+	}
+	return sink.Files, nil
+}
+
+// renderAhead 是每个 worker 最多可以领先写入的文件数。
+const renderAhead = 4
+
+// renderJob 是渲染计划中的一项输出：目录、符号链接或需要渲染内容的文件。
+type renderJob struct {
+	src    sourceEntry
+	file   string      // 源文件的相对路径（使用 / 分隔）
+	target string      // 目标路径（相对输出根目录，使用 / 分隔）
+	item   any         // 渲染文件内容时的 dot
+	link   string      // 已渲染的符号链接目标（使用 / 分隔）
+	mode   fs.FileMode // 目录和文件的权限
+	err    *RenderError
+	parsed *parsedContent // 解析后的内容模板，同一源文件的 fan-out 元素共用
+
+	content []byte        // 渲染完成的文件内容
+	done    chan struct{} // 文件内容渲染完成后关闭，目录和符号链接为 nil
+}
+
+// parsedContent 是只读取和解析一次的源文件内容模板。
+type parsedContent struct {
+	once    sync.Once
+	text    string // 源文件内容，用于截取出错位置附近的内容
+	tmpl    *template.Template
+	err     error // 解析错误
+	readErr error // 读取源文件的错误
+}
+
+// planRender 按源文件顺序渲染目标路径和符号链接目标，返回渲染计划。
+// 出错的输出以带 err 的项保留在计划中的相应位置；未设置 CollectErrors 时，计划在第一个错误处结束。
+func planRender(ctx context.Context, sources []sourceEntry, values map[string]any, opts RenderOptions, execute func(name, text string, data any) (string, error)) ([]*renderJob, error) {
+	var plan []*renderJob
+	// fail 把错误加入计划，返回 false 表示应停止生成计划
+	fail := func(e *RenderError) bool {
+		plan = append(plan, &renderJob{err: e})
+		return opts.CollectErrors
+	}
+	// written 记录每个目标路径来自哪个源文件，用于检测冲突
+	written := map[string]string{}
+	// dirs 记录已经加入计划的目录
+	dirs := map[string]bool{}
+
+	for _, src := range sources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		// 安全检查：防止路径遍历攻击
-		if filepath.IsAbs(targetRel) || strings.Contains(targetRel, "..") {
-			return fmt.Errorf("渲染后的路径 %s 包含非法字符，拒绝渲染", targetRel)
+		rel, file := src.rel, src.name
+		fanout, err := opts.fanoutFor(file)
+		if err != nil {
+			return nil, err
 		}
-		targetPath := filepath.Join(dstDir, targetRel)
 
-		if entry.IsDir() {
-			return os.MkdirAll(targetPath, 0o755)
+		if src.dir {
+			// 普通目录创建一次；路径中带 [[列表变量]] 标记的目录（及其中的子目录）对每个元素各创建一次，
+			// 空目录和目录权限因此与普通目录一致。manifest 规则匹配到的目录仍然跳过，规则的 path 描述的是文件
+			pathTemplate := rel
+			items := []any{values}
+			if fanout != nil {
+				if !fanoutMarker.MatchString(file) {
+					continue
+				}
+				pathTemplate = fanout.Path
+				if items, err = listValue(values, fanout.Each); err != nil {
+					if !fail(&RenderError{Stage: StagePath, File: file, Variable: fanout.Each, Message: err.Error(), Err: err}) {
+						return plan, nil
+					}
+					continue
+				}
+			}
+			for _, item := range items {
+				targetRel, err := execute("path", pathTemplate, item)
+				if err != nil {
+					if !fail(templateError(StagePath, file, "path", pathTemplate, nil, err)) {
+						return plan, nil
+					}
+					continue
+				}
+				targetRel = filepath.Clean(filepath.FromSlash(targetRel))
+				target := filepath.ToSlash(targetRel)
+				if err := checkTargetPath(targetRel); err != nil {
+					if !fail(&RenderError{Stage: StagePath, File: file, Path: target, Message: err.Error(), Err: err}) {
+						return plan, nil
+					}
+					continue
+				}
+				// 多个元素渲染到同一目录不算冲突，只创建一次
+				if dirs[target] {
+					continue
+				}
+				dirs[target] = true
+				mode, err := opts.fileMode(target, src.mode)
+				if err != nil {
+					return nil, err
+				}
+				plan = append(plan, &renderJob{src: src, file: file, target: target, mode: mode})
+			}
+			continue
 		}
 
-		if _, skip := skipFiles[strings.ToLower(entry.Name())]; skip {
-			return nil
+		// 符号链接按链接重建，链接目标同样可以使用模板语法；普通文件的内容由 worker 读取
+		var text string
+		if src.link {
+			if text, err = readLink(src.fsys, src.name); err != nil {
+				return nil, err
+			}
 		}
 
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
+		// 普通文件渲染一次，dot 为全部变量；fan-out 文件对列表中的每个元素渲染一次，dot 为该元素
+		pathTemplate := rel
+		items := []any{values}
+		if fanout != nil {
+			pathTemplate = fanout.Path
+			if items, err = listValue(values, fanout.Each); err != nil {
+				if !fail(&RenderError{Stage: StagePath, File: file, Variable: fanout.Each, Message: err.Error(), Err: err}) {
+					return plan, nil
+				}
+				continue
+			}
 		}
 
-		tmpl, err := template.New(rel).Funcs(funcs).Option("missingkey=error").Parse(string(data))
-		if err != nil {
-			return fmt.Errorf("解析模板 %s 失败: %w", rel, err)
-		}
+		parsed := &parsedContent{}
+		for _, item := range items {
+			targetRel, err := execute("path", pathTemplate, item)
+			if err != nil {
+				if !fail(templateError(StagePath, file, "path", pathTemplate, nil, err)) {
+					return plan, nil
+				}
+				continue
+			}
+			targetRel = filepath.Clean(filepath.FromSlash(targetRel))
+			target := filepath.ToSlash(targetRel)
+			if err := checkTargetPath(targetRel); err != nil {
+				if !fail(&RenderError{Stage: StagePath, File: file, Path: target, Message: err.Error(), Err: err}) {
+					return plan, nil
+				}
+				continue
+			}
+			if prev, ok := written[targetRel]; ok {
+				err := fmt.Errorf("路径冲突: %s 和 %s 都渲染到 %s", prev, rel, targetRel)
+				if prev == rel {
+					err = fmt.Errorf("路径冲突: %s 中的多个元素都渲染到 %s", fanout.Each, targetRel)
+				}
+				if !fail(&RenderError{Stage: StagePath, File: file, Path: target, Message: err.Error(), Err: err}) {
+					return plan, nil
+				}
+				continue
+			}
+			written[targetRel] = rel
 
-		var buf bytes.Buffer
-		if err := tmpl.Execute(&buf, values); err != nil {
-			return fmt.Errorf("渲染模板 %s 失败: %w", rel, err)
+			if src.link {
+				link, err := execute("link", text, item)
+				if err != nil {
+					if !fail(templateError(StageLink, file, "link", text, nil, err)) {
+						return plan, nil
+					}
+					continue
+				}
+				link = filepath.FromSlash(link)
+				if err := checkLinkTarget(targetRel, link); err != nil {
+					if !fail(&RenderError{Stage: StageLink, File: file, Path: target, Message: err.Error(), Err: err}) {
+						return plan, nil
+					}
+					continue
+				}
+				plan = append(plan, &renderJob{src: src, file: file, target: target, link: filepath.ToSlash(link)})
+				continue
+			}
+
+			plan = append(plan, &renderJob{src: src, file: file, target: target, item: item, parsed: parsed, done: make(chan struct{})})
 		}
+	}
+	return plan, nil
+}
 
-		if err := os.MkdirAll(filepath.Dir(targetPath), 0o755); err != nil {
-			return err
+// sourceEntry 是待渲染的源文件、目录或符号链接。
+type sourceEntry struct {
+	rel  string // 相对源目录的路径
+	name string // 在 fsys 中的路径（使用 / 分隔）
+	fsys fs.FS  // 所在的源文件系统
+	path string // 磁盘上的路径，源不是磁盘目录时为空
+	dir  bool
+	link bool        // 符号链接（不跟随）
+	mode fs.FileMode // 生成结果使用的权限，见 sourceMode
+}
+
+// collectSources 合并多个源文件系统（按优先级从低到高）中的文件，同一相对路径使用优先级最高的文件。
+// 结果按相对路径排序；.git、_partials/、manifest 文件和 exclude 中的路径不参与渲染。
+func collectSources(layers []fs.FS, exclude []string) ([]sourceEntry, error) {
+	excluded := map[string]bool{}
+	for _, rel := range exclude {
+		excluded[path.Clean(filepath.ToSlash(rel))] = true
+	}
+	entries := map[string]sourceEntry{}
+	for _, fsys := range layers {
+		err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name == "." {
+				return nil
+			}
+			if entry.Name() == ".git" {
+				return fs.SkipDir
+			}
+			if (name == PartialsDir && entry.IsDir()) || excluded[name] {
+				if entry.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if _, skip := skipFiles[strings.ToLower(entry.Name())]; skip && !entry.IsDir() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			entries[name] = sourceEntry{
+				rel:  filepath.FromSlash(name),
+				name: name,
+				fsys: fsys,
+				path: diskPath(fsys, name),
+				dir:  entry.IsDir(),
+				link: entry.Type()&fs.ModeSymlink != 0,
+				mode: sourceMode(fsys, info),
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	sources := make([]sourceEntry, 0, len(entries))
+	for _, e := range entries {
+		sources = append(sources, e)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].rel < sources[j].rel })
+	return sources, nil
+}
 
-		return os.WriteFile(targetPath, buf.Bytes(), 0o644)
-	})
+// checkTargetPath 防止渲染后的路径逃逸出目标目录（路径遍历攻击）。
+func checkTargetPath(targetRel string) error {
+	if filepath.IsAbs(targetRel) || strings.Contains(targetRel, "..") {
+		return fmt.Errorf("渲染后的路径 %s 包含非法字符，拒绝渲染", targetRel)
+	}
+	return nil
 }
 
-// buildFuncMap 将 values 映射转换为 template.FuncMap。
+// buildFuncMap 将 values 映射转换为 template.FuncMap，并加入 helperFuncs。
 // 这样在模板中可以直接使用 {{变量名}} 而不需要 {{.变量名}}。
-func buildFuncMap(values map[string]string) template.FuncMap {
+func buildFuncMap(values map[string]any) template.FuncMap {
 	funcs := template.FuncMap{}
+	for k, fn := range helperFuncs {
+		funcs[k] = fn
+	}
 	for k, v := range values {
+		// 不是标识符的名称无法在模板中引用，而且会让 Funcs panic
+		if !identPattern.MatchString(k) {
+			continue
+		}
 		val := v // 闭包捕获，确保每个函数返回正确的值
-		funcs[k] = func() string {
+		funcs[k] = func() any {
 			return val
 		}
 	}
 	return funcs
 }
-
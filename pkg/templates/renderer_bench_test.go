@@ -0,0 +1,104 @@
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// benchFiles 是基准测试模板中的普通文件数量，模拟大型 monorepo 模板。
+const benchFiles = 2000
+
+// benchValues 返回基准测试使用的变量，Services 用于 fan-out。
+func benchValues() map[string]any {
+	services := make([]any, 200)
+	for i := range services {
+		services[i] = map[string]any{"name": fmt.Sprintf("svc%03d", i), "port": 8000 + i}
+	}
+	return map[string]any{
+		"Name":     "bench",
+		"Module":   "example.com/bench",
+		"Features": []any{"auth", "metrics", "tracing", "cache"},
+		"Services": services,
+	}
+}
+
+// benchTemplate 创建基准测试模板：benchFiles 个分布在多层目录中的文件（路径和内容都使用模板语法），
+// 一个 fan-out 文件，以及一个 partial。
+func benchTemplate(b testing.TB) string {
+	b.Helper()
+	dir := b.TempDir()
+	body := strings.Repeat(`// {{Name | upper}} {{Module}}
+{{range $i, $f := Features}}func {{$f | pascal}}{{$i}}() string { return "{{$f | snake}}-{{Name}}" }
+{{end}}{{if eq Name "bench"}}const enabled = true{{else}}const enabled = false{{end}}
+`, 8) + `{{template "header" .}}
+`
+	for i := 0; i < benchFiles; i++ {
+		rel := filepath.Join(fmt.Sprintf("pkg%02d", i%20), fmt.Sprintf("sub%d", i%7), fmt.Sprintf("{{Name}}_%04d.go", i))
+		writeBenchFile(b, filepath.Join(dir, rel), "package {{Name}}\n\n"+body)
+	}
+	writeBenchFile(b, filepath.Join(dir, "services", "[[Services]]{{.name}}.yaml"), "name: {{.name}}\nport: {{.port}}\nmodule: {{Module}}\n")
+	writeBenchFile(b, filepath.Join(dir, PartialsDir, "header.txt"), "// Code generated for {{Name}}. DO NOT EDIT.\n")
+	return dir
+}
+
+func writeBenchFile(b testing.TB, path, content string) {
+	b.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchWorkers 返回对比的 worker 数量：逐个渲染和并发渲染。
+func benchWorkers() []int {
+	workers := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		workers = append(workers, n)
+	}
+	return workers
+}
+
+// BenchmarkRender 对比逐个渲染和并发渲染大型模板到磁盘的耗时。
+func BenchmarkRender(b *testing.B) {
+	src := benchTemplate(b)
+	values := benchValues()
+	for _, workers := range benchWorkers() {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			out := b.TempDir()
+			for i := 0; i < b.N; i++ {
+				dst := filepath.Join(out, fmt.Sprint(i))
+				if err := RenderWithOptions(src, dst, values, RenderOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				os.RemoveAll(dst)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkRenderFiles 对比逐个渲染和并发渲染大型模板到内存（预览）的耗时。
+func BenchmarkRenderFiles(b *testing.B) {
+	src := benchTemplate(b)
+	values := benchValues()
+	for _, workers := range benchWorkers() {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				files, err := RenderFilesWithOptions(src, values, RenderOptions{Workers: workers})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(files) != benchFiles+200 {
+					b.Fatalf("渲染了 %d 个文件，期望 %d 个", len(files), benchFiles+200)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestRenderer 使用 fstest.MapFS 和 MemorySink 覆盖 Renderer 的主要行为，不接触磁盘。
+func TestRenderer(t *testing.T) {
+	services := []any{map[string]any{"name": "api"}, map[string]any{"name": "web"}}
+	tests := []struct {
+		name     string
+		source   fstest.MapFS
+		partials []fs.FS
+		values   map[string]any
+		opts     RenderOptions
+		want     map[string]string      // 路径 -> 内容；符号链接为 "-> 目标"
+		modes    map[string]fs.FileMode // 需要检查权限的文件
+		err      string                 // 期望的错误（子串）
+		errFiles []string               // CollectErrors 时期望的出错文件，按顺序
+	}{
+		{
+			name: "路径和内容",
+			source: fstest.MapFS{
+				"README.md":              {Data: []byte("# {{Name}}\n")},
+				"cmd/{{Name}}/main.go":   {Data: []byte("package main // {{Name | upper}}\n")},
+				"docs/{{Name}}-guide.md": {Data: []byte("plain\n")},
+			},
+			values: map[string]any{"Name": "demo"},
+			want: map[string]string{
+				"README.md":          "# demo\n",
+				"cmd/demo/main.go":   "package main // DEMO\n",
+				"docs/demo-guide.md": "plain\n",
+			},
+		},
+		{
+			name: "fan-out 标记",
+			source: fstest.MapFS{
+				"svc/[[Services]]{{.name}}.yaml": {Data: []byte("name: {{.name}}\nproject: {{Name}}\n")},
+			},
+			values: map[string]any{"Name": "demo", "Services": services},
+			want: map[string]string{
+				"svc/api.yaml": "name: api\nproject: demo\n",
+				"svc/web.yaml": "name: web\nproject: demo\n",
+			},
+		},
+		{
+			name:   "fan-out 规则",
+			source: fstest.MapFS{"handler.go": {Data: []byte("// {{.name}}\n")}},
+			values: map[string]any{"Services": services},
+			opts:   RenderOptions{Fanout: []FanoutRule{{Files: "handler.go", Each: "Services", Path: "handlers/{{.name}}.go"}}},
+			want: map[string]string{
+				"handlers/api.go": "// api\n",
+				"handlers/web.go": "// web\n",
+			},
+		},
+		{
+			name:   "fan-out 空列表",
+			source: fstest.MapFS{"[[Services]]{{.name}}.txt": {Data: []byte("x")}},
+			values: map[string]any{"Services": []any{}},
+			want:   map[string]string{},
+		},
+		{
+			name:   "fan-out 元素路径冲突",
+			source: fstest.MapFS{"[[Services]]{{.kind}}.txt": {Data: []byte("x")}},
+			values: map[string]any{"Services": []any{map[string]any{"kind": "a"}, map[string]any{"kind": "a"}}},
+			err:    "Services 中的多个元素都渲染到 a.txt",
+		},
+		{
+			name: "不同文件路径冲突",
+			source: fstest.MapFS{
+				"a.txt":        {Data: []byte("1")},
+				"{{Name}}.txt": {Data: []byte("2")},
+			},
+			values: map[string]any{"Name": "a"},
+			err:    "路径冲突",
+		},
+		{
+			name:   "fan-out 变量不是列表",
+			source: fstest.MapFS{"[[Name]]x.txt": {Data: []byte("x")}},
+			values: map[string]any{"Name": "demo"},
+			err:    "fan-out 变量 Name 不是列表",
+		},
+		{
+			name:   "路径逃逸",
+			source: fstest.MapFS{"{{Name}}/x.txt": {Data: []byte("x")}},
+			values: map[string]any{"Name": ".."},
+			err:    "拒绝渲染",
+		},
+		{
+			name: "partial 优先级",
+			source: fstest.MapFS{
+				"main.txt":             {Data: []byte(`{{template "header" .}}|{{template "footer" .}}`)},
+				"_partials/header.txt": {Data: []byte("H:{{Name}}")},
+			},
+			partials: []fs.FS{fstest.MapFS{
+				"header.txt": {Data: []byte("shared header")},
+				"footer.txt": {Data: []byte("F:{{Name}}")},
+			}},
+			values: map[string]any{"Name": "demo"},
+			want:   map[string]string{"main.txt": "H:demo|F:demo"},
+		},
+		{
+			name:   "partial 中的错误",
+			source: fstest.MapFS{"main.txt": {Data: []byte(`{{template "header" .}}`)}},
+			partials: []fs.FS{fstest.MapFS{
+				"header.txt": {Data: []byte("line1\n{{Missing}}")},
+			}},
+			values: map[string]any{},
+			err:    "(partial header:2:3)",
+		},
+		{
+			name: "收集错误按源文件顺序",
+			source: fstest.MapFS{
+				"a.txt":       {Data: []byte("{{A}}")},
+				"b.txt":       {Data: []byte("ok")},
+				"c.txt":       {Data: []byte("{{if}}")},
+				"d/{{D}}.txt": {Data: []byte("x")},
+				"e.txt":       {Data: []byte("{{E}}")},
+				"f.txt":       {Data: []byte("ok")},
+			},
+			values:   map[string]any{},
+			opts:     RenderOptions{CollectErrors: true, Workers: 4},
+			errFiles: []string{"a.txt", "c.txt", "d/{{D}}.txt", "e.txt"},
+		},
+		{
+			name: "权限",
+			source: fstest.MapFS{
+				"run.sh":     {Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+				"secret.txt": {Data: []byte("s"), Mode: 0o600},
+				"key.pem":    {Data: []byte("k")},
+			},
+			values: map[string]any{},
+			opts:   RenderOptions{Modes: []ModeRule{{Files: "*.pem", Mode: "0600"}}},
+			want:   map[string]string{"run.sh": "#!/bin/sh\n", "secret.txt": "s", "key.pem": "k"},
+			// MapFS 的权限不可靠，只保留可执行位
+			modes: map[string]fs.FileMode{"run.sh": 0o755, "secret.txt": 0o644, "key.pem": 0o600},
+		},
+		{
+			name: "符号链接",
+			source: fstest.MapFS{
+				"{{Name}}.txt": {Data: []byte("x")},
+				"current":      {Data: []byte("{{Name}}.txt"), Mode: fs.ModeSymlink},
+			},
+			values: map[string]any{"Name": "demo"},
+			want:   map[string]string{"demo.txt": "x", "current": "-> demo.txt"},
+		},
+		{
+			name:   "符号链接逃逸",
+			source: fstest.MapFS{"link": {Data: []byte("../{{Name}}"), Mode: fs.ModeSymlink}},
+			values: map[string]any{"Name": "outside"},
+			err:    "link",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &MemorySink{}
+			r := &Renderer{Source: tt.source, Partials: tt.partials, Options: tt.opts}
+			err := r.Render(context.Background(), tt.values, sink)
+
+			if tt.errFiles != nil {
+				var errs RenderErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("期望 RenderErrors，得到 %v", err)
+				}
+				var files []string
+				for _, e := range errs {
+					files = append(files, e.File)
+				}
+				if !reflect.DeepEqual(files, tt.errFiles) {
+					t.Fatalf("出错文件为 %q，期望 %q", files, tt.errFiles)
+				}
+				return
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("错误为 %v，期望包含 %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]string{}
+			for _, f := range sink.Files {
+				if f.Link != "" {
+					got[f.Path] = "-> " + f.Link
+				} else {
+					got[f.Path] = string(f.Content)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("渲染结果为 %q，期望 %q", got, tt.want)
+			}
+			files := sink.Map()
+			for name, mode := range tt.modes {
+				if files[name].Mode != mode {
+					t.Errorf("%s 的权限为 %v，期望 %v", name, files[name].Mode, mode)
+				}
+			}
+		})
+	}
+}
+
+// TestRenderFanoutDirectories 确认 fan-out 目录中的子目录（包括空目录）对每个元素各创建一次，并应用权限规则。
+func TestRenderFanoutDirectories(t *testing.T) {
+	source := fstest.MapFS{
+		"svc/[[Services]]{{.name}}/main.go":       {Data: []byte("package {{.name}}\n")},
+		"svc/[[Services]]{{.name}}/data":          {Mode: fs.ModeDir | 0o755},
+		"svc/[[Services]]{{.name}}/private/cache": {Mode: fs.ModeDir | 0o755},
+	}
+	values := map[string]any{"Services": []any{map[string]any{"name": "api"}, map[string]any{"name": "web"}}}
+	opts := RenderOptions{Modes: []ModeRule{{Files: "svc/*/private", Mode: "0750"}}}
+	dst := t.TempDir()
+	if err := (&Renderer{Source: source, Options: opts}).Render(context.Background(), values, DirSink{Root: dst}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"api", "web"} {
+		for rel, mode := range map[string]fs.FileMode{"data": 0o755, "private": 0o750, "private/cache": 0o755} {
+			info, err := os.Stat(filepath.Join(dst, "svc", name, filepath.FromSlash(rel)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.IsDir() || info.Mode().Perm() != mode {
+				t.Errorf("svc/%s/%s 为 %v，期望权限为 %v 的目录", name, rel, info.Mode(), mode)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dst, "svc", name, "main.go")); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestRenderErrorLocation 确认内容错误带有行列号和出错位置附近的内容。
+func TestRenderErrorLocation(t *testing.T) {
+	source := fstest.MapFS{"main.go": {Data: []byte("package main\n\nvar x = {{Missing}}\n")}}
+	err := (&Renderer{Source: source}).Render(context.Background(), map[string]any{}, &MemorySink{})
+	var e *RenderError
+	if !errors.As(err, &e) {
+		t.Fatalf("期望 *RenderError，得到 %v", err)
+	}
+	if e.Stage != StageContent || e.File != "main.go" || e.Line != 3 || e.Col != 11 || e.Variable != "Missing" {
+		t.Fatalf("错误为 %+v", e)
+	}
+	if !strings.Contains(e.Snippet, "> 3 | var x = {{Missing}}") {
+		t.Fatalf("snippet 为\n%s", e.Snippet)
+	}
+}
+
+// TestRenderSyntaxErrorColumn 确认语法错误所在行只有一个动作时，列号指向该动作。
+func TestRenderSyntaxErrorColumn(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		line int
+		col  int
+	}{
+		{"ok\n  {{if}}\n", 2, 3},
+		{"{{Name}} {{if}}\n", 1, 0},
+	} {
+		source := fstest.MapFS{"c.txt": {Data: []byte(tt.text)}}
+		err := (&Renderer{Source: source}).Render(context.Background(), map[string]any{"Name": "demo"}, &MemorySink{})
+		var e *RenderError
+		if !errors.As(err, &e) {
+			t.Fatalf("%q: 期望 *RenderError，得到 %v", tt.text, err)
+		}
+		if e.Line != tt.line || e.Col != tt.col {
+			t.Errorf("%q: 位置为 %d:%d，期望 %d:%d", tt.text, e.Line, e.Col, tt.line, tt.col)
+		}
+	}
+}
+
+// TestRenderStopsAtFirstError 确认默认在第一个错误处停止：之前的文件已经写入 sink，之后的文件不再写入。
+func TestRenderStopsAtFirstError(t *testing.T) {
+	source := fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+		"b.txt": {Data: []byte("{{Missing}}")},
+		"c.txt": {Data: []byte("c")},
+	}
+	sink := &MemorySink{}
+	err := (&Renderer{Source: source, Options: RenderOptions{Workers: 4}}).Render(context.Background(), map[string]any{}, sink)
+	if err == nil {
+		t.Fatal("期望渲染失败")
+	}
+	if len(sink.Files) != 1 || sink.Files[0].Path != "a.txt" {
+		t.Fatalf("sink 中的文件为 %+v，期望只有 a.txt", sink.Files)
+	}
+}
+
+// TestRenderCanceled 确认 ctx 取消后返回 ctx.Err()，不再写入 sink。
+func TestRenderCanceled(t *testing.T) {
+	source := fstest.MapFS{"a.txt": {Data: []byte("a")}, "b.txt": {Data: []byte("b")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink := &MemorySink{}
+	err := (&Renderer{Source: source}).Render(ctx, map[string]any{}, sink)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误为 %v，期望 context.Canceled", err)
+	}
+	if len(sink.Files) != 0 {
+		t.Fatalf("取消后仍写入了 %d 个文件", len(sink.Files))
+	}
+}
+
+// cancelSink 在写入第 n 个文件后取消 ctx。
+type cancelSink struct {
+	MemorySink
+	n      int
+	cancel context.CancelFunc
+}
+
+func (s *cancelSink) WriteFile(name string, data []byte, mode fs.FileMode) error {
+	if err := s.MemorySink.WriteFile(name, data, mode); err != nil {
+		return err
+	}
+	if len(s.Files) == s.n {
+		s.cancel()
+	}
+	return nil
+}
+
+// TestRenderCanceledDuringRender 确认渲染过程中取消 ctx 后，已写入的文件保留，之后的文件不再写入。
+func TestRenderCanceledDuringRender(t *testing.T) {
+	source := fstest.MapFS{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		source[name+".txt"] = &fstest.MapFile{Data: []byte(name)}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := &cancelSink{n: 2, cancel: cancel}
+	err := (&Renderer{Source: source, Options: RenderOptions{Workers: 4}}).Render(ctx, map[string]any{}, sink)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误为 %v，期望 context.Canceled", err)
+	}
+	if len(sink.Files) != 2 {
+		t.Fatalf("写入了 %d 个文件，期望 2 个", len(sink.Files))
+	}
+}
+
+// TestRenderParallelMatchesSequential 确认并发渲染的结果（顺序、内容、权限）与逐个渲染完全相同。
+func TestRenderParallelMatchesSequential(t *testing.T) {
+	src := benchTemplate(t)
+	values := benchValues()
+	want, err := RenderFilesWithOptions(src, values, RenderOptions{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 8, 64} {
+		got, err := RenderFilesWithOptions(src, values, RenderOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("workers=%d: %v", workers, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("workers=%d: 渲染了 %d 个文件，期望 %d 个", workers, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].Path != want[i].Path || !bytes.Equal(got[i].Content, want[i].Content) || got[i].Mode != want[i].Mode || got[i].Link != want[i].Link {
+				t.Fatalf("workers=%d: 第 %d 个文件为 %s，期望 %s", workers, i, got[i].Path, want[i].Path)
+			}
+		}
+	}
+}
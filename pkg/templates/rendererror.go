@@ -0,0 +1,207 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 渲染错误发生的阶段。
+const (
+	StagePath    = "path"    // 渲染目标路径
+	StageContent = "content" // 渲染文件内容
+	StageLink    = "link"    // 渲染符号链接目标
+	StageFinish  = "finish"  // 格式化、转换换行符和设置权限
+)
+
+var stageLabels = map[string]string{
+	StagePath:    "渲染路径",
+	StageContent: "渲染模板",
+	StageLink:    "渲染符号链接",
+	StageFinish:  "处理",
+}
+
+// RenderError 描述渲染单个源文件时的错误，包含出错的位置和附近的源文件内容。
+type RenderError struct {
+	Stage    string `json:"stage"`              // 出错的阶段：path、content、link、finish
+	File     string `json:"file"`               // 源文件的相对路径（使用 / 分隔）
+	Path     string `json:"path,omitempty"`     // 渲染后的目标路径，路径本身渲染失败时为空
+	Partial  string `json:"partial,omitempty"`  // 错误发生在 partial 中时为 partial 名称，行列号相对于该 partial
+	Line     int    `json:"line,omitempty"`     // 行号，从 1 开始
+	Col      int    `json:"col,omitempty"`      // 列号（字节），从 1 开始
+	Variable string `json:"variable,omitempty"` // 出错的变量或函数名
+	Snippet  string `json:"snippet,omitempty"`  // 出错位置附近的源文件内容，带行号和 ^ 标记
+	Message  string `json:"message"`            // 去掉位置信息后的错误描述
+	Err      error  `json:"-"`                  // 原始错误
+}
+
+// Location 返回 file:line:col 形式的位置，错误在 partial 中时附带 partial 的位置。
+func (e *RenderError) Location() string {
+	pos := ""
+	if e.Line > 0 {
+		pos = ":" + strconv.Itoa(e.Line)
+		if e.Col > 0 {
+			pos += ":" + strconv.Itoa(e.Col)
+		}
+	}
+	if e.Partial != "" {
+		return fmt.Sprintf("%s (partial %s%s)", e.File, e.Partial, pos)
+	}
+	return e.File + pos
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("%s %s 失败: %s", stageLabels[e.Stage], e.Location(), e.Message)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// RenderErrors 是设置 CollectErrors 时一次渲染收集到的所有错误，按源文件的遍历顺序排列。
+type RenderErrors []*RenderError
+
+func (errs RenderErrors) Error() string {
+	lines := make([]string, 0, len(errs)+1)
+	lines = append(lines, fmt.Sprintf("%d 个渲染错误:", len(errs)))
+	for _, e := range errs {
+		lines = append(lines, "  "+e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs RenderErrors) Unwrap() []error {
+	list := make([]error, len(errs))
+	for i, e := range errs {
+		list[i] = e
+	}
+	return list
+}
+
+// AsRenderErrors 返回 err 中的渲染错误；err 不是渲染错误时返回 nil。
+func AsRenderErrors(err error) []*RenderError {
+	var list RenderErrors
+	if errors.As(err, &list) {
+		return list
+	}
+	var single *RenderError
+	if errors.As(err, &single) {
+		return []*RenderError{single}
+	}
+	return nil
+}
+
+var (
+	// templateErrorRe 匹配 text/template 错误开头的位置：template: 名称:行[:列]: 描述
+	templateErrorRe = regexp.MustCompile(`(?s)^template: (.*?):(\d+)(?::(\d+))?: (.*)$`)
+	// executingRe 匹配执行错误中的节点：executing "名称" at <节点>: 描述
+	executingRe = regexp.MustCompile(`(?s)^executing ".*?" at <(.*?)>: (.*)$`)
+	// variableRe 从错误描述中提取变量或函数名
+	variableRe = regexp.MustCompile(`(?:no entry for key "|function "|error calling |can't evaluate field )([A-Za-z_][A-Za-z0-9_]*)`)
+	// nodeVariableRe 匹配只包含变量或字段的节点，如 Name、.name
+	nodeVariableRe = regexp.MustCompile(`^\.?([A-Za-z_][A-Za-z0-9_]*)$`)
+)
+
+// templateError 将解析或执行 name 模板时的错误转换为 RenderError。
+// text 是该模板的源文本，partials 保存 partial 名称到源文本的映射，用于截取出错位置附近的内容。
+func templateError(stage, file, name, text string, partials map[string]string, err error) *RenderError {
+	e := &RenderError{Stage: stage, File: file, Message: err.Error(), Err: err}
+	m := templateErrorRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return e
+	}
+	e.Line, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		// text/template 的列号从 0 开始
+		col, _ := strconv.Atoi(m[3])
+		e.Col = col + 1
+	}
+	e.Message = m[4]
+	node := ""
+	if exec := executingRe.FindStringSubmatch(e.Message); exec != nil {
+		node, e.Message = exec[1], exec[2]
+	}
+	if v := variableRe.FindStringSubmatch(e.Message); v != nil {
+		e.Variable = v[1]
+	} else if v := nodeVariableRe.FindStringSubmatch(node); v != nil {
+		e.Variable = v[1]
+	}
+
+	// 文件中 {{define}} 的模板也以文件名报告位置，其他名称来自 partial
+	source := text
+	if m[1] != name {
+		partial, ok := partials[m[1]]
+		if !ok {
+			return e
+		}
+		e.Partial, source = m[1], partial
+	}
+	if e.Col == 0 && e.Variable != "" {
+		// 解析错误只有行号，用变量在该行中的位置作为列号
+		if i := strings.Index(sourceLine(source, e.Line), e.Variable); i >= 0 {
+			e.Col = i + 1
+		}
+	}
+	if e.Col == 0 {
+		e.Col = actionColumn(sourceLine(source, e.Line))
+	}
+	e.Snippet = snippet(source, e.Line, e.Col)
+	return e
+}
+
+// actionColumn 返回 line 中唯一一个 {{ 的列号（从 1 开始）。
+// text/template 的语法错误只有行号；该行只有一个动作时错误必然出在其中，有多个或没有动作时无法确定，返回 0。
+func actionColumn(line string) int {
+	if strings.Count(line, "{{") != 1 {
+		return 0
+	}
+	return strings.Index(line, "{{") + 1
+}
+
+// sourceLine 返回 source 的第 line 行（从 1 开始），不含换行符。
+func sourceLine(source string, line int) string {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[line-1], "\r")
+}
+
+// snippet 返回 source 中第 line 行及前后各一行，带行号；col 大于 0 时在出错列下方标出 ^。
+func snippet(source string, line, col int) string {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	first, last := max(line-1, 1), min(line+1, len(lines))
+	if last == len(lines) && lines[last-1] == "" && last > line {
+		// 文件末尾的换行符不算一行
+		last--
+	}
+	width := len(strconv.Itoa(last))
+	var b strings.Builder
+	for n := first; n <= last; n++ {
+		text := strings.TrimSuffix(lines[n-1], "\r")
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %*d | %s\n", marker, width, n, text)
+		if n == line && col > 0 && col-1 <= len(text) {
+			// 保留制表符，使 ^ 与出错位置对齐
+			var pad strings.Builder
+			for _, r := range text[:col-1] {
+				if r == '\t' {
+					pad.WriteRune('\t')
+				} else if r != utf8.RuneError {
+					pad.WriteByte(' ')
+				}
+			}
+			fmt.Fprintf(&b, "  %*s | %s^\n", width, "", pad.String())
+		}
+	}
+	return b.String()
+}
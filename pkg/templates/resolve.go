@@ -0,0 +1,159 @@
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvedTemplate 是展开 extends/include 之后的模板。
+type ResolvedTemplate struct {
+	Name     string
+	Path     string    // 模板自身的目录
+	Chain    []string  // 参与合成的模板，按优先级从低到高，最后一个是模板自身
+	Manifest *Manifest // 合并后的 manifest：子模板的同名字段覆盖父模板
+	roots    []string  // 与 Chain 一一对应的模板目录
+}
+
+// SourceDir 返回模板实际渲染的源目录：存在 template/ 子目录时使用它（常见模板仓库结构）。
+func SourceDir(templatePath string) string {
+	templateSubdir := filepath.Join(templatePath, "template")
+	if info, err := os.Stat(templateSubdir); err == nil && info.IsDir() {
+		return templateSubdir
+	}
+	return templatePath
+}
+
+// SourceDir 返回模板自身的源目录。
+func (r *ResolvedTemplate) SourceDir() string {
+	return SourceDir(r.Path)
+}
+
+// RenderOptions 返回渲染合成模板所需的选项：父模板和 include 的文件作为低优先级的层，
+// 各模板根目录下的 _partials/ 依次加入 partial 目录。
+// 模板文件直接放在根目录时，根目录下的测试用例目录 tests/ 不会输出。
+func (r *ResolvedTemplate) RenderOptions() RenderOptions {
+	opts := r.Manifest.RenderOptions()
+	excludeTests := false
+	for i, root := range r.roots {
+		if i < len(r.roots)-1 {
+			opts.Layers = append(opts.Layers, SourceDir(root))
+		}
+		opts.PartialDirs = append(opts.PartialDirs, filepath.Join(root, PartialsDir))
+		if SourceDir(root) == root && hasTestCases(root) {
+			excludeTests = true
+		}
+	}
+	if excludeTests {
+		opts.Exclude = append(opts.Exclude, TestsDir)
+	}
+	return opts
+}
+
+// Resolve 加载模板并展开 extends/include。
+// 合成顺序（优先级从低到高）：extends 的父模板、include 中的模板（按声明顺序）、模板自身；
+// 同一模板被多次引用时只使用一次，循环引用会返回错误。
+func (m *Manager) Resolve(name string) (*ResolvedTemplate, error) {
+	r := &chainResolver{manager: m, done: map[string]bool{}}
+	if err := r.visit(name, nil); err != nil {
+		return nil, err
+	}
+
+	last := len(r.chain) - 1
+	return &ResolvedTemplate{
+		Name:     name,
+		Path:     r.roots[last],
+		Chain:    r.chain,
+		Manifest: mergeManifests(r.manifests),
+		roots:    r.roots,
+	}, nil
+}
+
+type chainResolver struct {
+	manager   *Manager
+	done      map[string]bool
+	chain     []string
+	roots     []string
+	manifests []*Manifest
+}
+
+func (r *chainResolver) visit(name string, stack []string) error {
+	for i, n := range stack {
+		if n == name {
+			cycle := append(append([]string{}, stack[i:]...), name)
+			return fmt.Errorf("模板继承存在循环引用: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if r.done[name] {
+		return nil
+	}
+
+	path, err := r.manager.TemplatePath(name)
+	if err != nil {
+		if len(stack) > 0 {
+			return fmt.Errorf("模板 %s 引用的模板 %s 不存在", stack[len(stack)-1], name)
+		}
+		return err
+	}
+	manifest, _, err := LoadManifest(path)
+	if err != nil {
+		return fmt.Errorf("加载模板 %s 失败: %w", name, err)
+	}
+
+	stack = append(stack, name)
+	if manifest.Extends != "" {
+		if err := r.visit(manifest.Extends, stack); err != nil {
+			return err
+		}
+	}
+	for _, inc := range manifest.Include {
+		if err := r.visit(inc, stack); err != nil {
+			return err
+		}
+	}
+
+	r.done[name] = true
+	r.chain = append(r.chain, name)
+	r.roots = append(r.roots, path)
+	r.manifests = append(r.manifests, manifest)
+	return nil
+}
+
+// mergeManifests 按优先级从低到高合并 manifest。
+// 名称、描述、版本等取自最后一个（模板自身）；字段按名称合并，后者覆盖前者并保留首次出现的位置；
+// trimBlocks 取最后一个设置了它的模板；检查规则依次追加。
+// fan-out、格式化、换行符和权限规则按第一条匹配的规则生效，因此按优先级从高到低排列，子模板的规则优先于父模板中匹配同一文件的规则。
+func mergeManifests(manifests []*Manifest) *Manifest {
+	merged := *manifests[len(manifests)-1]
+	merged.Fields = nil
+	merged.Fanout = nil
+	merged.Checks = nil
+	merged.Format = nil
+	merged.EOL = nil
+	merged.TrimBlocks = nil
+	merged.Modes = nil
+
+	index := map[string]int{}
+	for _, m := range manifests {
+		for _, f := range m.Fields {
+			if i, ok := index[f.Name]; ok {
+				merged.Fields[i] = f
+				continue
+			}
+			index[f.Name] = len(merged.Fields)
+			merged.Fields = append(merged.Fields, f)
+		}
+		merged.Checks = append(merged.Checks, m.Checks...)
+		if m.TrimBlocks != nil {
+			merged.TrimBlocks = m.TrimBlocks
+		}
+	}
+	for i := len(manifests) - 1; i >= 0; i-- {
+		merged.Fanout = append(merged.Fanout, manifests[i].Fanout...)
+		merged.Format = append(merged.Format, manifests[i].Format...)
+		merged.EOL = append(merged.EOL, manifests[i].EOL...)
+		merged.Modes = append(merged.Modes, manifests[i].Modes...)
+	}
+	return &merged
+}
@@ -0,0 +1,139 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jundy/kuai/pkg/config"
+)
+
+// newTestManager 在临时目录中创建模板（模板名 -> 相对路径 -> 内容），返回使用该目录的 Manager。
+func newTestManager(t *testing.T, tmpls map[string]map[string]string) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	for name, files := range tmpls {
+		writeTree(t, filepath.Join(dir, name), files)
+	}
+	return NewManager(config.Paths{TemplatesDir: dir})
+}
+
+// renderResolved 展开模板并渲染到临时目录，返回生成结果。
+func renderResolved(t *testing.T, m *Manager, name string, values map[string]any) (string, map[string]string) {
+	t.Helper()
+	resolved, err := m.Resolve(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	if err := RenderWithOptions(resolved.SourceDir(), dst, values, resolved.RenderOptions()); err != nil {
+		t.Fatal(err)
+	}
+	return dst, treeContents(t, dst)
+}
+
+// TestResolveFanoutChildOverridesParent 确认父子模板的 fan-out 规则匹配同一文件时，子模板的规则生效。
+func TestResolveFanoutChildOverridesParent(t *testing.T) {
+	m := newTestManager(t, map[string]map[string]string{
+		"base": {
+			"kuai.yaml":  "name: base\nfanout:\n  - files: handler.go\n    each: Services\n    path: \"parent/{{.}}.go\"\n",
+			"handler.go": "// {{.}}\n",
+		},
+		"child": {
+			"kuai.yaml": "name: child\nextends: base\nfanout:\n  - files: handler.go\n    each: Services\n    path: \"child/{{.}}.go\"\n",
+			"main.go":   "package main\n",
+		},
+	})
+	_, got := renderResolved(t, m, "child", map[string]any{"Services": []any{"api", "web"}})
+	for _, name := range []string{"child/api.go", "child/web.go"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("缺少 %s，生成结果为 %q", name, got)
+		}
+	}
+	if _, ok := got["parent/api.go"]; ok {
+		t.Errorf("父模板的 fan-out 规则覆盖了子模板的规则: %q", got)
+	}
+}
+
+// TestResolveTrimBlocksInherited 确认 trimBlocks 未设置时沿用父模板，显式设置时覆盖父模板。
+func TestResolveTrimBlocksInherited(t *testing.T) {
+	tests := []struct {
+		name  string
+		child string
+		want  string
+	}{
+		{name: "继承", child: "name: child\nextends: base\n", want: "a\nb\n"},
+		{name: "覆盖", child: "name: child\nextends: base\ntrimBlocks: false\n", want: "\na\n\nb\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, map[string]map[string]string{
+				"base": {
+					"kuai.yaml": "name: base\ntrimBlocks: true\n",
+					"list.txt":  "{{range Items}}\n{{.}}\n{{end}}\n",
+				},
+				"child": {"kuai.yaml": tt.child, "main.txt": "x\n"},
+			})
+			_, got := renderResolved(t, m, "child", map[string]any{"Items": []any{"a", "b"}})
+			if got["list.txt"] != tt.want {
+				t.Fatalf("list.txt 为 %q，期望 %q", got["list.txt"], tt.want)
+			}
+		})
+	}
+}
+
+// TestResolveEOLChildOverridesParent 确认父子模板的换行符规则匹配同一文件时，子模板的规则生效。
+func TestResolveEOLChildOverridesParent(t *testing.T) {
+	m := newTestManager(t, map[string]map[string]string{
+		"base": {
+			"kuai.yaml": "name: base\neol:\n  - files: \"*.txt\"\n    style: crlf\n",
+			"a.txt":     "1\n2\n",
+		},
+		"child": {
+			"kuai.yaml": "name: child\nextends: base\neol:\n  - files: \"*.txt\"\n    style: lf\n",
+			"b.txt":     "3\r\n4\r\n",
+		},
+	})
+	_, got := renderResolved(t, m, "child", map[string]any{})
+	if got["a.txt"] != "1\n2\n" || got["b.txt"] != "3\n4\n" {
+		t.Fatalf("生成结果为 %q，期望使用子模板的 lf 规则", got)
+	}
+}
+
+// TestResolveModesChildOverridesParent 确认父子模板的权限规则匹配同一文件时，子模板的规则生效。
+func TestResolveModesChildOverridesParent(t *testing.T) {
+	m := newTestManager(t, map[string]map[string]string{
+		"base": {
+			"kuai.yaml": "name: base\nmodes:\n  - files: \"*.sh\"\n    mode: \"0700\"\n",
+			"build.sh":  "#!/bin/sh\n",
+		},
+		"child": {
+			"kuai.yaml": "name: child\nextends: base\nmodes:\n  - files: \"*.sh\"\n    mode: \"0755\"\n",
+			"main.go":   "package main\n",
+		},
+	})
+	dst, _ := renderResolved(t, m, "child", map[string]any{})
+	info, err := os.Stat(filepath.Join(dst, "build.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o755 {
+		t.Fatalf("build.sh 的权限为 %v，期望子模板的 0755", info.Mode().Perm())
+	}
+}
+
+func TestResolveFormatChildOverridesParent(t *testing.T) {
+	m := newTestManager(t, map[string]map[string]string{
+		"base": {
+			"kuai.yaml": "name: base\nformat:\n  - files: \"*.json\"\n    with: yaml\n",
+		},
+		"child": {
+			"kuai.yaml": "name: child\nextends: base\nformat:\n  - files: \"*.json\"\n    with: json\n",
+			"a.json":    `{"a":1}`,
+		},
+	})
+	_, got := renderResolved(t, m, "child", map[string]any{})
+	if want := "{\n  \"a\": 1\n}\n"; got["a.json"] != want {
+		t.Fatalf("a.json 为 %q，期望使用子模板的 json 格式化 %q", got["a.json"], want)
+	}
+}
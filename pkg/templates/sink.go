@@ -0,0 +1,136 @@
+package templates
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sink 接收 Renderer 的渲染结果。name 是相对输出根目录、使用 / 分隔的路径，已确认不会逃逸出根目录；
+// 符号链接的 target 同样使用 / 分隔，且不会指向根目录之外。
+// Renderer 在同一个 goroutine 中按源文件的顺序调用 Sink，实现不需要考虑并发。
+// 渲染出错或 ctx 取消时，Renderer 不会撤销已经写入的内容：出错之前的文件保留在 Sink 中。
+// 需要“要么全部生成、要么不生成”时，可以写入 Staging 的暂存目录，成功后再提交，或在出错时丢弃 MemorySink 的结果。
+type Sink interface {
+	Mkdir(name string, mode fs.FileMode) error
+	WriteFile(name string, data []byte, mode fs.FileMode) error
+	Symlink(name, target string) error
+}
+
+// DirSink 将渲染结果写入磁盘目录 Root。经过已有符号链接的路径会被拒绝，串联的链接不能把文件写到 Root 之外。
+type DirSink struct {
+	Root string
+}
+
+func (s DirSink) Mkdir(name string, mode fs.FileMode) error {
+	if err := checkNoSymlink(s.Root, filepath.FromSlash(name)); err != nil {
+		return err
+	}
+	// 保留源目录的权限，但所有者始终可以在目录中继续写入文件
+	target := filepath.Join(s.Root, filepath.FromSlash(name))
+	if err := os.MkdirAll(target, mode|0o700); err != nil {
+		return err
+	}
+	return os.Chmod(target, mode|0o700)
+}
+
+func (s DirSink) WriteFile(name string, data []byte, mode fs.FileMode) error {
+	if err := checkNoSymlink(s.Root, filepath.FromSlash(name)); err != nil {
+		return err
+	}
+	target := filepath.Join(s.Root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, data, mode); err != nil {
+		return err
+	}
+	// WriteFile 只在创建文件时使用 mode，且受 umask 影响
+	return os.Chmod(target, mode)
+}
+
+func (s DirSink) Symlink(name, target string) error {
+	if err := checkNoSymlink(s.Root, filepath.FromSlash(name)); err != nil {
+		return err
+	}
+	link := filepath.Join(s.Root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(target), link)
+}
+
+// MemorySink 将渲染结果按顺序保存在内存中，适用于预览和测试。目录不会被记录。
+type MemorySink struct {
+	Files []RenderedFile
+}
+
+func (s *MemorySink) Mkdir(string, fs.FileMode) error { return nil }
+
+func (s *MemorySink) WriteFile(name string, data []byte, mode fs.FileMode) error {
+	s.Files = append(s.Files, RenderedFile{Path: name, Content: data, Mode: mode})
+	return nil
+}
+
+func (s *MemorySink) Symlink(name, target string) error {
+	s.Files = append(s.Files, RenderedFile{Path: name, Mode: fs.ModeSymlink | 0o777, Link: target})
+	return nil
+}
+
+// Map 返回以路径为键的渲染结果。
+func (s *MemorySink) Map() map[string]RenderedFile {
+	files := make(map[string]RenderedFile, len(s.Files))
+	for _, f := range s.Files {
+		files[f.Path] = f
+	}
+	return files
+}
+
+// ZipSink 将渲染结果写入 ZIP，与 ZipDir 一样保留权限并把符号链接保存为链接。
+// 渲染完成后需要调用 Close 写入 ZIP 的目录区，Close 不会关闭底层的 io.Writer。
+type ZipSink struct {
+	zw  *zip.Writer
+	now time.Time
+}
+
+// NewZipSink 返回写入 w 的 ZipSink。
+func NewZipSink(w io.Writer) *ZipSink {
+	return &ZipSink{zw: zip.NewWriter(w), now: time.Now()}
+}
+
+func (s *ZipSink) Mkdir(name string, mode fs.FileMode) error {
+	_, err := s.create(name+"/", fs.ModeDir|mode|0o700, zip.Store)
+	return err
+}
+
+func (s *ZipSink) WriteFile(name string, data []byte, mode fs.FileMode) error {
+	w, err := s.create(name, mode, zip.Deflate)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (s *ZipSink) Symlink(name, target string) error {
+	w, err := s.create(name, fs.ModeSymlink|0o777, zip.Store)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+// Close 完成 ZIP 文件。
+func (s *ZipSink) Close() error {
+	return s.zw.Close()
+}
+
+func (s *ZipSink) create(name string, mode fs.FileMode, method uint16) (io.Writer, error) {
+	header := &zip.FileHeader{Name: name, Method: method, Modified: s.now}
+	header.SetMode(mode)
+	return s.zw.CreateHeader(header)
+}
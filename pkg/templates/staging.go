@@ -0,0 +1,118 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Staging 是与目标目录位于同一目录下的暂存目录。
+// 先渲染到暂存目录，成功后调用 Commit 替换目标目录；失败或中断时调用 Cleanup 删除暂存目录，目标目录保持原样。
+type Staging struct {
+	Dir    string // 暂存目录，渲染结果写入这里
+	Target string // 目标目录
+
+	mu   sync.Mutex
+	done bool // 已经提交或清理
+}
+
+// NewStaging 在目标目录旁边创建暂存目录。暂存目录与目标在同一文件系统中，提交时可以直接重命名。
+func NewStaging(target string) (*Staging, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, ".kuai-"+filepath.Base(target)+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建暂存目录失败: %w", err)
+	}
+	return &Staging{Dir: dir, Target: target}, nil
+}
+
+// Commit 用暂存目录的内容替换目标目录。
+// 目标目录不存在时直接重命名暂存目录；已存在时保留目标目录本身（权限、挂载点、当前工作目录不受影响），
+// 先把原有内容移到备份目录，再移入新内容，任一步失败都会恢复原有内容。
+func (s *Staging) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return errors.New("暂存目录已提交或清理")
+	}
+
+	info, err := os.Stat(s.Target)
+	if errors.Is(err, os.ErrNotExist) {
+		// MkdirTemp 创建的目录权限为 0700
+		if err := os.Chmod(s.Dir, 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(s.Dir, s.Target); err != nil {
+			return fmt.Errorf("移动生成结果到 %s 失败: %w", s.Target, err)
+		}
+		s.done = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("目标 %s 已存在且不是目录", s.Target)
+	}
+
+	backup, err := os.MkdirTemp(filepath.Dir(s.Target), ".kuai-"+filepath.Base(s.Target)+"-backup-*")
+	if err != nil {
+		return fmt.Errorf("创建备份目录失败: %w", err)
+	}
+	if err := moveEntries(s.Target, backup); err != nil {
+		// 已移走的内容移回目标目录
+		if rerr := moveEntries(backup, s.Target); rerr != nil {
+			return fmt.Errorf("备份 %s 失败: %w（恢复失败，原有内容保存在 %s）", s.Target, err, backup)
+		}
+		os.Remove(backup)
+		return fmt.Errorf("备份 %s 失败: %w", s.Target, err)
+	}
+	if err := moveEntries(s.Dir, s.Target); err != nil {
+		// 新内容移回暂存目录，再恢复原有内容
+		if rerr := errors.Join(moveEntries(s.Target, s.Dir), moveEntries(backup, s.Target)); rerr != nil {
+			return fmt.Errorf("移动生成结果到 %s 失败: %w（恢复失败，原有内容保存在 %s）", s.Target, err, backup)
+		}
+		os.Remove(backup)
+		return fmt.Errorf("移动生成结果到 %s 失败: %w", s.Target, err)
+	}
+	s.done = true
+	os.Remove(s.Dir)
+	if err := os.RemoveAll(backup); err != nil {
+		return fmt.Errorf("删除备份目录 %s 失败: %w", backup, err)
+	}
+	return nil
+}
+
+// Cleanup 删除暂存目录；已经提交或清理过时不做任何操作，可以重复调用。
+func (s *Staging) Cleanup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return nil
+	}
+	s.done = true
+	return os.RemoveAll(s.Dir)
+}
+
+// moveEntries 将 src 目录下的所有条目重命名到 dst 目录。
+func moveEntries(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeTree 在 dir 中创建 files 描述的文件（相对路径 -> 内容）。
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// treeContents 返回 dir 中所有文件的相对路径（使用 / 分隔）和内容，见 readTree。
+func treeContents(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree, err := readTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string, len(tree))
+	for rel, data := range tree {
+		files[rel] = string(data)
+	}
+	return files
+}
+
+// leftovers 返回 parent 中除 keep 之外的条目，用于确认暂存目录和备份目录都已删除。
+func leftovers(t *testing.T, parent string, keep ...string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	sort.Strings(keep)
+	if !reflect.DeepEqual(names, keep) {
+		return names
+	}
+	return nil
+}
+
+func TestStagingCommitNewTarget(t *testing.T) {
+	parent := t.TempDir()
+	target := filepath.Join(parent, "demo")
+	s, err := NewStaging(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, s.Dir, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := treeContents(t, target), map[string]string{"a.txt": "a", "sub/b.txt": "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("目标目录为 %q，期望 %q", got, want)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o755 {
+		t.Errorf("目标目录权限为 %v，期望 0755", info.Mode().Perm())
+	}
+	if extra := leftovers(t, parent, "demo"); extra != nil {
+		t.Errorf("提交后残留 %q", extra)
+	}
+	// 提交后 Cleanup 不做任何操作
+	if err := s.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "a.txt")); err != nil {
+		t.Fatal("Cleanup 删除了已提交的结果")
+	}
+}
+
+func TestStagingCommitReplacesExisting(t *testing.T) {
+	parent := t.TempDir()
+	target := filepath.Join(parent, "demo")
+	writeTree(t, target, map[string]string{"old.txt": "old", "a.txt": "old a"})
+	s, err := NewStaging(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, s.Dir, map[string]string{"a.txt": "new a", "new/b.txt": "b"})
+	if err := s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := treeContents(t, target), map[string]string{"a.txt": "new a", "new/b.txt": "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("目标目录为 %q，期望 %q", got, want)
+	}
+	if extra := leftovers(t, parent, "demo"); extra != nil {
+		t.Errorf("提交后残留 %q", extra)
+	}
+	if err := s.Commit(); err == nil {
+		t.Error("重复提交应该失败")
+	}
+}
+
+// TestStagingCleanupKeepsTarget 模拟渲染失败：调用 Cleanup 后目标目录保持原样，暂存目录被删除。
+func TestStagingCleanupKeepsTarget(t *testing.T) {
+	parent := t.TempDir()
+	target := filepath.Join(parent, "demo")
+	original := map[string]string{"keep.txt": "keep", "sub/x.txt": "x"}
+	writeTree(t, target, original)
+	s, err := NewStaging(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, s.Dir, map[string]string{"keep.txt": "partial"})
+	if err := s.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cleanup(); err != nil {
+		t.Fatalf("重复 Cleanup 失败: %v", err)
+	}
+	if got := treeContents(t, target); !reflect.DeepEqual(got, original) {
+		t.Fatalf("目标目录为 %q，期望保持 %q", got, original)
+	}
+	if extra := leftovers(t, parent, "demo"); extra != nil {
+		t.Errorf("清理后残留 %q", extra)
+	}
+	if err := s.Commit(); err == nil {
+		t.Error("清理后提交应该失败")
+	}
+}
+
+// TestStagingCommitRollback 让移入新内容失败（暂存目录已被删除），确认目标目录恢复为原有内容。
+func TestStagingCommitRollback(t *testing.T) {
+	parent := t.TempDir()
+	target := filepath.Join(parent, "demo")
+	original := map[string]string{"keep.txt": "keep", "sub/x.txt": "x"}
+	writeTree(t, target, original)
+	s, err := NewStaging(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(s.Dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(); err == nil {
+		t.Fatal("期望提交失败")
+	}
+	if got := treeContents(t, target); !reflect.DeepEqual(got, original) {
+		t.Fatalf("目标目录为 %q，期望恢复为 %q", got, original)
+	}
+	if extra := leftovers(t, parent, "demo"); extra != nil {
+		t.Errorf("回滚后残留 %q", extra)
+	}
+}
@@ -0,0 +1,132 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 字段类型。
+const (
+	FieldTypeString = "string" // 默认类型
+	FieldTypeList   = "list"   // 列表，可在模板中 range
+	FieldTypeObject = "object" // 对象（嵌套的键值），可通过 .a.b 或 index 访问
+)
+
+// parseFieldValue 将字符串形式的输入（交互输入、Web 表单、默认值）转换为字段类型对应的值。
+// list 接受逗号分隔的文本或 JSON/YAML 数组，object 接受 JSON/YAML 对象。
+func parseFieldValue(field Field, s string) (any, error) {
+	switch field.Type {
+	case FieldTypeList:
+		s = strings.TrimSpace(s)
+		list := []any{}
+		if strings.HasPrefix(s, "[") {
+			if err := yaml.Unmarshal([]byte(s), &list); err != nil {
+				return nil, fmt.Errorf("字段 %s 需要列表: %v", field.Name, err)
+			}
+			return list, nil
+		}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	case FieldTypeObject:
+		obj := map[string]any{}
+		if strings.TrimSpace(s) == "" {
+			return obj, nil
+		}
+		if err := yaml.Unmarshal([]byte(s), &obj); err != nil {
+			return nil, fmt.Errorf("字段 %s 需要 JSON/YAML 对象: %v", field.Name, err)
+		}
+		return obj, nil
+	default:
+		return s, nil
+	}
+}
+
+// coerceFieldValues 将 list/object 字段中以字符串提供的值（如 --var deps=a,b）解析为对应类型。
+func coerceFieldValues(manifest *Manifest, values map[string]any) []FieldError {
+	var fieldErrs []FieldError
+	for _, field := range manifest.Fields {
+		s, ok := values[field.Name].(string)
+		if !ok || s == "" || field.Type == "" || field.Type == FieldTypeString {
+			continue
+		}
+		value, err := parseFieldValue(field, s)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: field.Name, Message: err.Error()})
+			continue
+		}
+		values[field.Name] = value
+	}
+	return fieldErrs
+}
+
+// isEmptyValue 判断变量是否未提供：nil、空字符串、空列表或空对象。
+func isEmptyValue(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// setPath 按 key 路径设置变量：a.b 设置嵌套对象的字段，末尾的 [] 表示向列表追加元素。
+// 同一个键不能既是字符串又是对象或列表，无论先设置哪一个都会返回错误。
+func setPath(values map[string]any, key, value string) error {
+	parts := strings.Split(key, ".")
+	current := values
+	for i, part := range parts {
+		last := i == len(parts)-1
+		appendItem := last && strings.HasSuffix(part, "[]")
+		name := part
+		if appendItem {
+			name = strings.TrimSuffix(part, "[]")
+		}
+		if name == "" || strings.ContainsAny(name, "[]") {
+			return fmt.Errorf("变量名 %q 不合法", key)
+		}
+
+		switch {
+		case appendItem:
+			existing, ok := current[name]
+			if !ok || existing == nil {
+				existing = []any{}
+			}
+			list, ok := existing.([]any)
+			if !ok {
+				return fmt.Errorf("%s 不是列表", name)
+			}
+			current[name] = append(list, value)
+		case last:
+			switch current[name].(type) {
+			case map[string]any:
+				return fmt.Errorf("%s 是对象，不能设置为字符串", name)
+			case []any:
+				return fmt.Errorf("%s 是列表，不能设置为字符串", name)
+			}
+			current[name] = value
+		default:
+			next, ok := current[name]
+			if !ok || next == nil {
+				next = map[string]any{}
+				current[name] = next
+			}
+			obj, ok := next.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s 不是对象", name)
+			}
+			current = obj
+		}
+	}
+	return nil
+}
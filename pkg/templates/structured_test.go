@@ -0,0 +1,126 @@
+package templates
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs [][2]string
+		want  map[string]any
+	}{
+		{
+			name:  "顶层变量",
+			pairs: [][2]string{{"Name", "demo"}, {"Name", "again"}},
+			want:  map[string]any{"Name": "again"},
+		},
+		{
+			name:  "嵌套对象",
+			pairs: [][2]string{{"db.host", "localhost"}, {"db.port", "5432"}, {"db.pool.max", "10"}},
+			want: map[string]any{"db": map[string]any{
+				"host": "localhost",
+				"port": "5432",
+				"pool": map[string]any{"max": "10"},
+			}},
+		},
+		{
+			name:  "追加列表元素",
+			pairs: [][2]string{{"deps[]", "redis"}, {"deps[]", "kafka"}, {"svc.ports[]", "80"}},
+			want: map[string]any{
+				"deps": []any{"redis", "kafka"},
+				"svc":  map[string]any{"ports": []any{"80"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]any{}
+			for _, p := range tt.pairs {
+				if err := setPath(values, p[0], p[1]); err != nil {
+					t.Fatalf("%s=%s: %v", p[0], p[1], err)
+				}
+			}
+			if !reflect.DeepEqual(values, tt.want) {
+				t.Errorf("结果为 %#v，期望 %#v", values, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetPathErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs [][2]string
+		err   string
+	}{
+		{"先字符串后对象", [][2]string{{"db", "x"}, {"db.host", "y"}}, "db 不是对象"},
+		{"先对象后字符串", [][2]string{{"db.host", "y"}, {"db", "x"}}, "db 是对象"},
+		{"嵌套的先字符串后对象", [][2]string{{"a.b", "x"}, {"a.b.c", "y"}}, "b 不是对象"},
+		{"先字符串后列表", [][2]string{{"deps", "x"}, {"deps[]", "y"}}, "deps 不是列表"},
+		{"先列表后字符串", [][2]string{{"deps[]", "y"}, {"deps", "x"}}, "deps 是列表"},
+		{"列表后对象", [][2]string{{"deps[]", "y"}, {"deps.a", "x"}}, "deps 不是对象"},
+		{"空路径片段", [][2]string{{"a..b", "x"}}, "不合法"},
+		{"中间的 []", [][2]string{{"a[].b", "x"}}, "不合法"},
+		{"空变量名", [][2]string{{"", "x"}}, "不合法"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]any{}
+			var err error
+			for _, p := range tt.pairs {
+				if err = setPath(values, p[0], p[1]); err != nil {
+					break
+				}
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("错误为 %v，期望包含 %q（变量为 %#v）", err, tt.err, values)
+			}
+		})
+	}
+}
+
+func TestParseFieldValue(t *testing.T) {
+	list := Field{Name: "Deps", Type: FieldTypeList}
+	object := Field{Name: "DB", Type: FieldTypeObject}
+	tests := []struct {
+		field Field
+		in    string
+		want  any
+	}{
+		{Field{Name: "Name"}, " a, b ", " a, b "},
+		{list, "a, b,,c ", []any{"a", "b", "c"}},
+		{list, "", []any{}},
+		{list, `["a", 1, {"k": "v"}]`, []any{"a", 1, map[string]any{"k": "v"}}},
+		{list, "[a, [b, c]]", []any{"a", []any{"b", "c"}}},
+		{object, "", map[string]any{}},
+		{object, `{"host": "db", "pool": {"max": 10}}`, map[string]any{"host": "db", "pool": map[string]any{"max": 10}}},
+		{object, "host: db\nports: [80, 443]\n", map[string]any{"host": "db", "ports": []any{80, 443}}},
+	}
+	for _, tt := range tests {
+		got, err := parseFieldValue(tt.field, tt.in)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tt.field.Name, tt.in, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q 解析为 %#v，期望 %#v", tt.field.Name, tt.in, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		field Field
+		in    string
+	}{
+		{list, "[a, b"},
+		{list, "[a: b: c]"},
+		{object, "[a, b]"},
+		{object, "just text"},
+		{object, "{host: "},
+	} {
+		if _, err := parseFieldValue(tt.field, tt.in); err == nil {
+			t.Errorf("%s %q 应该解析失败", tt.field.Name, tt.in)
+		}
+	}
+}
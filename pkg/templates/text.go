@@ -0,0 +1,148 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// 换行符风格。
+const (
+	EOLLF     = "lf"
+	EOLCRLF   = "crlf"
+	EOLNative = "native" // 运行 kuai 的系统的换行符：Windows 为 crlf，其他为 lf
+)
+
+// EOLRule 指定匹配的生成文件使用的换行符。
+type EOLRule struct {
+	Files string `json:"files,omitempty" yaml:"files,omitempty"` // 目标路径的 glob（同 format），为空时匹配所有文件
+	Style string `json:"style" yaml:"style"`                     // lf、crlf 或 native
+}
+
+// validate 检查规则是否有效。
+func (r EOLRule) validate() error {
+	if r.Files != "" {
+		if _, err := globRegexp(r.Files); err != nil {
+			return fmt.Errorf("换行符规则 %q 无效: %w", r.Files, err)
+		}
+	}
+	switch r.Style {
+	case EOLLF, EOLCRLF, EOLNative:
+		return nil
+	default:
+		return fmt.Errorf("换行符风格 %q 无效，可选 lf、crlf、native", r.Style)
+	}
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// blockAction 匹配不产生输出的动作：控制结构、注释和变量赋值。
+const blockAction = `\{\{-?\s*(?:/\*[\s\S]*?\*/|(?:if|else|end|range|with|define|break|continue)\b[^}]*|\$\w*\s*:?=[^}]*)\s*-?\}\}`
+
+var (
+	blockActionRe = regexp.MustCompile(blockAction)
+	// blockLine 匹配只包含 blockAction 的行（包括缩进、动作之间的空白和换行符），允许以 BOM 开头。
+	blockLine = regexp.MustCompile(`(?m)^\x{FEFF}?[ \t]*(?:` + blockAction + `[ \t]*)+\r?\n`)
+)
+
+// trimBlockLines 去掉只包含控制结构等动作的行中动作以外的空白和换行符，使这些行渲染后不留下空行。
+// 去掉的空白被移入模板注释而不是删除，模板的行列号保持不变，错误信息中的位置仍对应源文件。
+// 文件开头的 BOM 会被保留。
+func trimBlockLines(text string) string {
+	return blockLine.ReplaceAllStringFunc(text, func(line string) string {
+		var b strings.Builder
+		if strings.HasPrefix(line, "\uFEFF") {
+			b.WriteString("\uFEFF")
+			line = line[len("\uFEFF"):]
+		}
+		actions := blockActionRe.FindAllStringIndex(line, -1)
+		pos := 0
+		for i, loc := range actions {
+			// 动作带有 {{- 或 -}} 时，注释同样去掉两侧的空白，保持原有的效果
+			leftTrim := i == 0 && strings.HasPrefix(line[loc[0]:], "{{-")
+			b.WriteString(hideText(line[pos:loc[0]], leftTrim, false))
+			b.WriteString(line[loc[0]:loc[1]])
+			pos = loc[1]
+		}
+		rightTrim := strings.HasSuffix(line[:pos], "-}}")
+		b.WriteString(hideText(line[pos:], false, rightTrim))
+		return b.String()
+	})
+}
+
+// hideText 将空白放入模板注释，使其不产生输出；trimLeft/trimRight 为 true 时注释同时去掉前面/后面的空白。
+func hideText(text string, trimLeft, trimRight bool) string {
+	if text == "" {
+		return ""
+	}
+	open, end := "{{/*", "*/}}"
+	if trimLeft {
+		open = "{{- /*"
+	}
+	if trimRight {
+		end = "*/ -}}"
+	}
+	return open + text + end
+}
+
+// prepareTemplate 在解析前处理模板文本。
+func (o RenderOptions) prepareTemplate(text string) string {
+	if o.TrimBlocks {
+		return trimBlockLines(text)
+	}
+	return text
+}
+
+// finishContent 处理渲染后的文件内容：依次格式化和转换换行符，文件开头的 BOM 会被保留。二进制文件原样返回。
+// ctx 取消时外部格式化命令会被终止。
+func (o RenderOptions) finishContent(ctx context.Context, rel string, content []byte) ([]byte, error) {
+	if isBinary(content) {
+		return content, nil
+	}
+	body, hasBOM := bytes.CutPrefix(content, utf8BOM)
+	body, err := o.formatFile(ctx, rel, body)
+	if err != nil {
+		return nil, err
+	}
+	if body, err = o.convertEOL(rel, body); err != nil {
+		return nil, err
+	}
+	if hasBOM {
+		body = append(append([]byte{}, utf8BOM...), body...)
+	}
+	return body, nil
+}
+
+// convertEOL 按第一条匹配 rel 的规则转换换行符，没有匹配的规则时原样返回。
+func (o RenderOptions) convertEOL(rel string, content []byte) ([]byte, error) {
+	for _, rule := range o.EOL {
+		if rule.Files != "" {
+			matched, err := matchGlob(rule.Files, rel)
+			if err != nil {
+				return nil, fmt.Errorf("换行符规则 %q 无效: %w", rule.Files, err)
+			}
+			if !matched {
+				continue
+			}
+		}
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		style := rule.Style
+		if style == EOLNative {
+			style = EOLLF
+			if runtime.GOOS == "windows" {
+				style = EOLCRLF
+			}
+		}
+		lf := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		if style == EOLCRLF {
+			return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n")), nil
+		}
+		return lf, nil
+	}
+	return content, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/manifoldco/promptui"
@@ -17,13 +18,23 @@ type ValuesConfig struct {
 	FromFile   string    // 从文件加载变量（JSON/YAML）
 	RawPairs   []string  // 从命令行参数加载变量（key=value 格式）
 	UseDefault bool      // 是否跳过交互，直接使用默认值
+	// UserDefaults 是用户配置中的个人默认值，覆盖 manifest 默认值，并作为交互提示的默认值。
+	UserDefaults map[string]string
+	// Builtins 是内置变量（见 Builtins），仅在其他来源未提供同名变量时使用。
+	Builtins map[string]string
 }
 
+// EnvVarPrefix 是注入变量的环境变量前缀，例如 KUAI_VAR_Name=demo 设置变量 Name。
+const EnvVarPrefix = "KUAI_VAR_"
+
 // CollectValues 根据 manifest 加载变量。
-// 优先级：命令行参数 > 文件 > 交互式输入 > 默认值。
-// 如果 UseDefault 为 true，会跳过交互式输入，直接使用默认值。
-func CollectValues(cfg ValuesConfig) (map[string]string, error) {
-	values := map[string]string{}
+// 优先级：命令行参数 > KUAI_VAR_* 环境变量 > 文件 > 交互式输入 > 用户配置默认值 > manifest 默认值 > 内置变量。
+// 默认值可以是引用其他变量的模板表达式（如 "{{kebab Name}}"），在需要时基于已收集的变量计算。
+// 如果 UseDefault 为 true，会跳过交互式输入，按 ApplyDefaults 直接使用默认值。
+// 计算字段在所有变量就绪后按依赖顺序计算。
+func CollectValues(cfg ValuesConfig) (map[string]any, error) {
+	values := map[string]any{}
+	MergeBuiltins(cfg.Manifest, values, cfg.Builtins)
 
 	// 先加载文件
 	if cfg.FromFile != "" {
@@ -34,6 +45,9 @@ func CollectValues(cfg ValuesConfig) (map[string]string, error) {
 		merge(values, fileValues)
 	}
 
+	// 环境变量注入
+	merge(values, envValues(os.Environ()))
+
 	// 解析 CLI 变量
 	cliValues, err := parsePairs(cfg.RawPairs)
 	if err != nil {
@@ -45,55 +59,191 @@ func CollectValues(cfg ValuesConfig) (map[string]string, error) {
 	if cfg.Manifest == nil {
 		return values, nil
 	}
+	manifest := withUserDefaults(cfg.Manifest, cfg.UserDefaults)
 
-	for _, field := range cfg.Manifest.Fields {
-		if _, ok := values[field.Name]; ok {
-			continue
+	if cfg.UseDefault {
+		if err := ApplyDefaults(manifest, values); err != nil {
+			return nil, err
 		}
-		if cfg.UseDefault {
-			if field.Default == "" && field.Required {
-				return nil, fmt.Errorf("字段 %s 需要提供值", field.Name)
-			}
-			if field.Default != "" {
-				values[field.Name] = field.Default
-			}
+	} else if err := promptValues(manifest, values); err != nil {
+		return nil, err
+	}
+
+	if err := ComputeFields(manifest, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// MergeBuiltins 将 values 中未设置的内置变量补齐。
+// manifest 中声明了同名字段时以字段为准，不使用内置变量。
+func MergeBuiltins(manifest *Manifest, values map[string]any, builtins map[string]string) {
+	declared := map[string]bool{}
+	if manifest != nil {
+		for _, f := range manifest.Fields {
+			declared[f.Name] = true
+		}
+	}
+	for k, v := range builtins {
+		if _, ok := values[k]; !ok && !declared[k] {
+			values[k] = v
+		}
+	}
+}
+
+// promptValues 交互式地询问尚未提供的字段。
+func promptValues(manifest *Manifest, values map[string]any) error {
+	if fieldErrs := coerceFieldValues(manifest, values); len(fieldErrs) > 0 {
+		return &ValidationError{Fields: fieldErrs}
+	}
+	for _, field := range manifest.Fields {
+		if _, ok := values[field.Name]; ok || field.Computed() {
 			continue
 		}
+		// 默认值表达式基于此前的回答计算
+		def, err := evalDefault(manifest, values, field.Name)
+		if err != nil {
+			return err
+		}
 		prompt := promptui.Prompt{
 			Label:     buildPromptLabel(field),
-			Default:   field.Default,
+			Default:   def,
 			AllowEdit: true,
 		}
 		answer, err := prompt.Run()
 		if err != nil {
 			// 如果是 Ctrl+C 等取消操作，直接返回错误
 			if err.Error() == "^C" {
-				return nil, fmt.Errorf("操作已取消")
+				return fmt.Errorf("操作已取消")
 			}
-			return nil, fmt.Errorf("读取字段 %s 失败: %w", field.Name, err)
+			return fmt.Errorf("读取字段 %s 失败: %w", field.Name, err)
 		}
 		// promptui 的行为：如果设置了 Default，用户直接回车会返回 Default 值
 		// 如果用户输入了内容，返回用户输入的内容
 		// 如果 Default 为空且用户直接回车，返回空字符串
-		if answer != "" {
-			// 用户输入了值或使用了默认值，直接使用
-			values[field.Name] = answer
-		} else {
-			// answer 为空
-			if field.Default != "" {
-				// 有默认值，使用默认值（虽然 promptui 应该已经返回了，但为了保险起见）
-			values[field.Name] = field.Default
-			} else if field.Required {
-				// 必填字段且没有默认值，报错
-				return nil, fmt.Errorf("字段 %s 不能为空", field.Name)
-			} else {
-				// 非必填字段且没有默认值，设置为空字符串，避免模板渲染时报错
-				values[field.Name] = ""
-			}
+		if answer == "" {
+			// 有默认值时使用默认值（虽然 promptui 应该已经返回了，但为了保险起见）
+			answer = def
+		}
+		if answer == "" && field.Required {
+			// 必填字段且没有默认值，报错
+			return fmt.Errorf("字段 %s 不能为空", field.Name)
+		}
+		// 非必填字段且没有默认值时得到该类型的空值，避免模板渲染时报错
+		value, err := parseFieldValue(field, answer)
+		if err != nil {
+			return err
 		}
+		values[field.Name] = value
 	}
+	return nil
+}
 
-	return values, nil
+// envValues 从环境变量中提取 KUAI_VAR_ 前缀的变量。
+func envValues(environ []string) map[string]any {
+	values := map[string]any{}
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, EnvVarPrefix) {
+			continue
+		}
+		if name := strings.TrimPrefix(key, EnvVarPrefix); name != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// FieldError 描述单个字段的校验错误。
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 汇总所有校验失败的字段，便于调用方（如 Web 表单）逐个高亮。
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ApplyDefaults 按 manifest 非交互地补齐变量。
+// 缺失或为空的字段使用默认值（表达式会基于已有变量计算）；必填字段仍为空时记录到 *ValidationError 中；
+// 非必填且无默认值的字段设置为该类型的空值，避免模板渲染时报错。计算字段由 ComputeFields 处理。
+// list/object 字段以字符串形式提供时（如 Web 表单）会被解析为列表或对象。
+func ApplyDefaults(manifest *Manifest, values map[string]any) error {
+	if manifest == nil {
+		return nil
+	}
+	if err := ValidateValueNames(values); err != nil {
+		return err
+	}
+	fieldErrs := coerceFieldValues(manifest, values)
+	for _, field := range manifest.Fields {
+		if field.Computed() || !isEmptyValue(values[field.Name]) {
+			continue
+		}
+		def, err := evalDefault(manifest, values, field.Name)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: field.Name, Message: err.Error()})
+			continue
+		}
+		if def == "" && field.Required {
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:   field.Name,
+				Message: fmt.Sprintf("字段 %s 需要提供值", field.Name),
+			})
+			continue
+		}
+		value, err := parseFieldValue(field, def)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: field.Name, Message: err.Error()})
+			continue
+		}
+		values[field.Name] = value
+	}
+	if len(fieldErrs) > 0 {
+		return &ValidationError{Fields: fieldErrs}
+	}
+	return nil
+}
+
+// ValidateValueNames 检查变量名是否都是合法的标识符，不合法的名称无法在模板中引用，以 *ValidationError 返回。
+// 来自不可信来源（如 Web 请求）的变量应先经过该检查，再参与默认值、计算字段和渲染。
+func ValidateValueNames(values map[string]any) error {
+	var fieldErrs []FieldError
+	for name := range values {
+		if !identPattern.MatchString(name) {
+			fieldErrs = append(fieldErrs, FieldError{Field: name, Message: fmt.Sprintf("变量名 %q 不是合法的标识符", name)})
+		}
+	}
+	if len(fieldErrs) == 0 {
+		return nil
+	}
+	sort.Slice(fieldErrs, func(i, j int) bool { return fieldErrs[i].Field < fieldErrs[j].Field })
+	return &ValidationError{Fields: fieldErrs}
+}
+
+// withUserDefaults 返回 manifest 的副本，其中字段默认值被用户配置覆盖。
+func withUserDefaults(manifest *Manifest, defaults map[string]string) *Manifest {
+	if len(defaults) == 0 {
+		return manifest
+	}
+	copied := *manifest
+	copied.Fields = make([]Field, len(manifest.Fields))
+	for i, field := range manifest.Fields {
+		if v, ok := defaults[field.Name]; ok {
+			field.Default = v
+		}
+		copied.Fields[i] = field
+	}
+	return &copied
 }
 
 func buildPromptLabel(field Field) string {
@@ -107,12 +257,13 @@ func buildPromptLabel(field Field) string {
 	return label
 }
 
-func loadValuesFile(path string) (map[string]string, error) {
+// loadValuesFile 读取 JSON/YAML 变量文件，支持列表和嵌套对象。
+func loadValuesFile(path string) (map[string]any, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("读取变量文件失败: %w", err)
 	}
-	result := map[string]string{}
+	result := map[string]any{}
 	switch strings.ToLower(filepath.Ext(path)) {
 	case ".yaml", ".yml":
 		if err := yaml.Unmarshal(content, &result); err != nil {
@@ -126,21 +277,31 @@ func loadValuesFile(path string) (map[string]string, error) {
 	return result, nil
 }
 
-func parsePairs(items []string) (map[string]string, error) {
-	values := map[string]string{}
+// parsePairs 解析 key=value 形式的变量。
+// key 支持 deps[]=redis 追加列表元素、db.host=localhost 设置嵌套对象的字段。
+func parsePairs(items []string) (map[string]any, error) {
+	values := map[string]any{}
 	for _, item := range items {
 		parts := strings.SplitN(item, "=", 2)
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("无法解析变量 %q，需要 key=value 形式", item)
 		}
-		values[parts[0]] = parts[1]
+		if err := setPath(values, parts[0], parts[1]); err != nil {
+			return nil, fmt.Errorf("无法解析变量 %q: %w", item, err)
+		}
 	}
 	return values, nil
 }
 
-func merge(dst, src map[string]string) {
+// merge 将 src 合并到 dst，两边都是对象的键会递归合并，其余直接覆盖。
+func merge(dst, src map[string]any) {
 	for k, v := range src {
+		if sm, ok := v.(map[string]any); ok {
+			if dm, ok := dst[k].(map[string]any); ok {
+				merge(dm, sm)
+				continue
+			}
+		}
 		dst[k] = v
 	}
 }
-
@@ -0,0 +1,5 @@
+// Package version 保存 kuai 的版本号。
+package version
+
+// Version 在发布构建时通过 -ldflags "-X github.com/jundy/kuai/pkg/version.Version=v1.2.3" 注入。
+var Version = "dev"
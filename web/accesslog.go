@@ -0,0 +1,59 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessLogEntry 是一条结构化访问日志。
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Route     string    `json:"route,omitempty"`
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latencyMs"`
+	Bytes     int       `json:"bytes"`
+	ClientIP  string    `json:"clientIp"`
+	User      string    `json:"user"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// accessLogger 以 JSON Lines 格式输出访问日志，替代 gin 默认的文本日志。
+func accessLogger(w io.Writer, requestUser func(*gin.Context) string) gin.HandlerFunc {
+	var mu sync.Mutex
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := accessLogEntry{
+			Time:      start,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Route:     c.FullPath(),
+			Status:    c.Writer.Status(),
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			Bytes:     c.Writer.Size(),
+			ClientIP:  c.ClientIP(),
+			User:      requestUser(c),
+			UserAgent: c.Request.UserAgent(),
+			Error:     c.Errors.ByType(gin.ErrorTypePrivate).String(),
+		}
+		if entry.Bytes < 0 {
+			entry.Bytes = 0
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(data, '\n'))
+	}
+}
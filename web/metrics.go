@@ -0,0 +1,167 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics 汇总 Web 服务暴露给 Prometheus 的指标。
+// 使用独立的 Registry，避免与嵌入 kuai 的程序的全局指标冲突。
+type metrics struct {
+	registry           *prometheus.Registry
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	generations        *prometheus.CounterVec
+	generationDuration *prometheus.HistogramVec
+	renderFailures     *prometheus.CounterVec
+	uploadSize         prometheus.Histogram
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kuai",
+			Name:      "http_requests_total",
+			Help:      "HTTP 请求数，按路由、方法和状态码统计。",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "kuai",
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP 请求耗时，按路由和方法统计。",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		generations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kuai",
+			Name:      "generations_total",
+			Help:      "项目生成次数，按模板和结果统计。",
+		}, []string{"template", "outcome"}),
+		generationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "kuai",
+			Name:      "generation_duration_seconds",
+			Help:      "项目生成（渲染并打包）耗时，按模板统计。",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"template"}),
+		renderFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "kuai",
+			Name:      "render_failures_total",
+			Help:      "模板渲染失败次数，按模板统计。",
+		}, []string{"template"}),
+		uploadSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "kuai",
+			Name:      "upload_size_bytes",
+			Help:      "上传的模板 ZIP 大小。",
+			Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+		}),
+	}
+
+	artifactBytes := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "kuai",
+		Name:      "artifact_store_bytes",
+		Help:      "临时目录中待下载的项目 ZIP 占用的磁盘空间。",
+	}, artifactStoreUsage)
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.generations,
+		m.generationDuration,
+		m.renderFailures,
+		m.uploadSize,
+		artifactBytes,
+	)
+	return m
+}
+
+// middleware 记录每个请求的次数和耗时。
+// 使用路由模板（如 /api/templates/:name）作为标签，避免路径参数导致标签基数膨胀。
+func (m *metrics) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		m.requests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		m.requestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// handler 返回 /metrics 的处理函数。
+func (m *metrics) handler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return gin.WrapH(h)
+}
+
+// observeGeneration 记录一次生成的结果和耗时。
+func (m *metrics) observeGeneration(template string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	m.generations.WithLabelValues(template, outcome).Inc()
+	m.generationDuration.WithLabelValues(template).Observe(time.Since(start).Seconds())
+}
+
+// artifactStoreUsage 统计临时目录中生成的项目 ZIP 总大小。
+func artifactStoreUsage() float64 {
+	matches, err := filepath.Glob(filepath.Join(os.TempDir(), "kuai-project-*.zip"))
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return float64(total)
+}
+
+// handleHealthz 是存活探针，进程能响应即视为健康。
+func (s *Server) handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz 是就绪探针：模板目录可读且临时目录可写时才接收流量。
+func (s *Server) handleReadyz(c *gin.Context) {
+	checks := gin.H{}
+	ready := true
+
+	if _, err := os.ReadDir(s.paths.TemplatesDir); err != nil {
+		checks["templates"] = err.Error()
+		ready = false
+	} else {
+		checks["templates"] = "ok"
+	}
+
+	if f, err := os.CreateTemp("", "kuai-readyz-*"); err != nil {
+		checks["tempDir"] = err.Error()
+		ready = false
+	} else {
+		f.Close()
+		os.Remove(f.Name())
+		checks["tempDir"] = "ok"
+	}
+
+	status := http.StatusOK
+	state := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		state = "not ready"
+	}
+	c.JSON(status, gin.H{"status": state, "checks": checks})
+}
@@ -1,20 +1,26 @@
 package web
 
 import (
-	"archive/zip"
+	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gopkg.in/yaml.v3"
 
+	"github.com/jundy/kuai/pkg/audit"
 	"github.com/jundy/kuai/pkg/config"
 	"github.com/jundy/kuai/pkg/templates"
 )
@@ -25,20 +31,51 @@ var staticFiles embed.FS
 type Server struct {
 	templateMgr *templates.Manager
 	paths       config.Paths
+	opts        Options
 	engine      *gin.Engine
+	audit       *audit.Logger
+	metrics     *metrics
+	downloads   sync.Map          // downloadId -> 模板名，用于审计下载事件
+	trustedNets []*net.IPNet      // 可信代理，只有来自它们的身份头才会被采信
+	builtins    map[string]string // 启动时计算的内置变量，生成时只刷新日期等与请求相关的部分
 }
 
-func NewServer(templateMgr *templates.Manager, paths config.Paths) *Server {
+// Options 配置 Web 服务在生产环境中的行为。
+type Options struct {
+	BasePath       string    // 部署在反向代理的路径前缀下时使用，如 /kuai
+	MaxUploadSize  int64     // 上传请求体大小上限（字节），0 表示不限制
+	TrustedProxies []string  // 可信代理的 IP/CIDR，只有来自它们的 X-Forwarded-For 和身份头（X-Forwarded-User 等）才会被采信
+	AccessLog      io.Writer // JSON 访问日志输出，nil 表示不记录
+}
+
+func NewServer(templateMgr *templates.Manager, paths config.Paths, opts Options) (*Server, error) {
 	gin.SetMode(gin.ReleaseMode)
-	engine := gin.Default()
-	
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(opts.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("解析可信代理失败: %w", err)
+	}
+	trustedNets, err := parseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("解析可信代理失败: %w", err)
+	}
+	opts.BasePath = normalizeBasePath(opts.BasePath)
+
 	s := &Server{
 		templateMgr: templateMgr,
 		paths:       paths,
+		opts:        opts,
 		engine:      engine,
+		audit:       audit.NewLogger(paths.HistoryFile),
+		metrics:     newMetrics(),
+		trustedNets: trustedNets,
+		builtins:    serverBuiltins(),
+	}
+	if opts.AccessLog != nil {
+		engine.Use(accessLogger(opts.AccessLog, s.requestUser))
 	}
+	engine.Use(gin.Recovery(), s.metrics.middleware())
 	s.setupRoutes()
-	return s
+	return s, nil
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -46,21 +83,31 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) setupRoutes() {
+	// 健康检查与监控不受路径前缀影响，便于探针直接访问
+	s.engine.GET("/healthz", s.handleHealthz)
+	s.engine.GET("/readyz", s.handleReadyz)
+	s.engine.GET("/metrics", s.metrics.handler())
+
+	root := s.engine.Group(s.opts.BasePath + "/")
+
 	// 静态文件
 	staticFS, _ := fs.Sub(staticFiles, "static")
-	s.engine.StaticFS("/static", http.FS(staticFS))
+	root.StaticFS("/static", http.FS(staticFS))
 	
 	// 首页
-	s.engine.GET("/", s.handleIndex)
+	root.GET("/", s.handleIndex)
 	
 	// API 路由
-	api := s.engine.Group("/api")
+	api := root.Group("/api")
 	{
 		api.GET("/templates", s.handleTemplates)
 		api.GET("/templates/:name", s.handleTemplateDetail)
-		api.POST("/upload", s.handleUpload)
+		api.POST("/templates/:name/preview", s.handlePreview)
+		api.POST("/templates/:name/defaults", s.handleDefaults)
+		api.POST("/upload", s.limitBody(), s.handleUpload)
 		api.POST("/generate", s.handleGenerate)
 		api.GET("/download/:id", s.handleDownload)
+		api.GET("/history", s.handleHistory)
 	}
 }
 
@@ -70,6 +117,8 @@ func (s *Server) handleIndex(c *gin.Context) {
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
+	// 注入路径前缀，前端据此拼接静态资源和 API 地址
+	data = bytes.ReplaceAll(data, []byte("__KUAI_BASE_PATH__"), []byte(s.opts.BasePath))
 	c.Data(http.StatusOK, "text/html; charset=utf-8", data)
 }
 
@@ -84,39 +133,50 @@ func (s *Server) handleTemplates(c *gin.Context) {
 
 func (s *Server) handleTemplateDetail(c *gin.Context) {
 	templateName := c.Param("name")
-	templatePath, err := s.templateMgr.TemplatePath(templateName)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		return
-	}
-
-	manifest, _, err := templates.LoadManifest(templatePath)
+	resolved, status, err := s.resolveTemplate(templateName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, manifest)
+	c.JSON(http.StatusOK, resolved.Manifest)
 }
 
 func (s *Server) handleUpload(c *gin.Context) {
+	ev := &audit.Event{Action: audit.ActionUpload}
+	defer s.record(c, ev)
+
+	// 先解析表单，请求体超过 --max-upload-size 时直接返回 413
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			s.fail(c, ev, http.StatusRequestEntityTooLarge, fmt.Sprintf("上传文件超过大小限制（%d 字节）", maxErr.Limit))
+			return
+		}
+		s.fail(c, ev, http.StatusBadRequest, err.Error())
+		return
+	}
 	templateName := c.PostForm("name")
+	ev.Template = templateName
+
 	if templateName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Template name required"})
+		s.fail(c, ev, http.StatusBadRequest, "Template name required")
 		return
 	}
 
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		s.fail(c, ev, http.StatusBadRequest, err.Error())
 		return
 	}
 	defer file.Close()
+	ev.Detail = fmt.Sprintf("%s (%d bytes)", header.Filename, header.Size)
+	s.metrics.uploadSize.Observe(float64(header.Size))
 
 	// 创建临时目录
 	tmpDir := filepath.Join(os.TempDir(), fmt.Sprintf("kuai-upload-%d", time.Now().UnixNano()))
 	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, ev, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer os.RemoveAll(tmpDir)
@@ -125,13 +185,13 @@ func (s *Server) handleUpload(c *gin.Context) {
 	uploadPath := filepath.Join(tmpDir, header.Filename)
 	dst, err := os.Create(uploadPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, ev, http.StatusInternalServerError, err.Error())
 		return
 	}
 	defer dst.Close()
 
 	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.fail(c, ev, http.StatusInternalServerError, err.Error())
 		return
 	}
 	dst.Close()
@@ -139,20 +199,28 @@ func (s *Server) handleUpload(c *gin.Context) {
 	// 判断文件类型并处理
 	extractDir := filepath.Join(tmpDir, "extracted")
 	if strings.HasSuffix(strings.ToLower(header.Filename), ".zip") {
-		if err := extractZip(uploadPath, extractDir); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to extract zip: %v", err)})
+		if err := templates.ExtractZip(uploadPath, extractDir); err != nil {
+			s.fail(c, ev, http.StatusBadRequest, fmt.Sprintf("Failed to extract zip: %v", err))
 			return
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only ZIP files are supported"})
+		s.fail(c, ev, http.StatusBadRequest, "Only ZIP files are supported")
 		return
 	}
 
+	// 上传的模板不可信，不能包含会在服务端执行的外部格式化命令
+	if manifest, _, err := templates.LoadManifest(extractDir); err == nil {
+		if commands := manifest.ExternalFormatters(); len(commands) > 0 {
+			s.fail(c, ev, http.StatusBadRequest, fmt.Sprintf("上传的模板不能包含外部格式化命令（format 中的 run: %q）", commands[0]))
+			return
+		}
+	}
+
 	// 添加模板
 	// checkbox 选中时值为 "on"，未选中时不存在
 	force := c.PostForm("force") != ""
 	if err := s.templateMgr.Add(templateName, extractDir, force); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		s.fail(c, ev, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -167,76 +235,240 @@ func (s *Server) handleUpload(c *gin.Context) {
 			}
 		}
 	}
+	ev.Version = s.templateVersion(templateName)
 
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "模板已添加"})
 }
 
 func (s *Server) handleGenerate(c *gin.Context) {
 	var req struct {
-		TemplateName string            `json:"templateName"`
-		Values        map[string]string `json:"values"`
+		TemplateName string         `json:"templateName"`
+		Values       map[string]any `json:"values"`
+		Target       string         `json:"target"` // 项目名，用作 TargetDir/TargetBase，默认使用模板名
 	}
 
+	ev := &audit.Event{Action: audit.ActionGenerate}
+	defer s.record(c, ev)
+
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		s.fail(c, ev, http.StatusBadRequest, err.Error())
 		return
 	}
+	ev.Template = req.TemplateName
 
-	templatePath, err := s.templateMgr.TemplatePath(req.TemplateName)
+	resolved, status, err := s.resolveTemplate(req.TemplateName)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		s.fail(c, ev, status, err.Error())
 		return
 	}
+	manifest := resolved.Manifest
 
-	// 创建临时目录用于生成项目
-	outputDir := filepath.Join(os.TempDir(), fmt.Sprintf("kuai-gen-%d", time.Now().UnixNano()))
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 与 CLI 的 --defaults 模式一致：补齐默认值并校验必填字段
+	ev.Version = manifest.Meta.Version
+	if req.Values == nil {
+		req.Values = map[string]any{}
+	}
+	builtins := s.builtinValues(req.TemplateName, req.Target)
+	templates.MergeBuiltins(manifest, req.Values, builtins)
+	if err := templates.ApplyDefaults(manifest, req.Values); err != nil {
+		ev.Values = audit.RedactValues(withoutBuiltins(req.Values, builtins), manifest.SecretFields())
+		ev.Error = err.Error()
+		respondValidationError(c, err)
 		return
 	}
+	ev.Values = audit.RedactValues(withoutBuiltins(req.Values, builtins), manifest.SecretFields())
 
-	// 添加 TemplateName
-	req.Values["TemplateName"] = req.TemplateName
-
-	// 检查是否有 template/ 子目录
-	actualTemplatePath := templatePath
-	templateSubdir := filepath.Join(templatePath, "template")
-	if info, err := os.Stat(templateSubdir); err == nil && info.IsDir() {
-		actualTemplatePath = templateSubdir
-	}
+	// 模板已确认存在后才记录生成指标，避免任意模板名导致标签基数膨胀
+	start := time.Now()
+	var genErr error
+	defer func() { s.metrics.observeGeneration(req.TemplateName, start, genErr) }()
 
-	// 渲染模板
-	if err := templates.Render(actualTemplatePath, outputDir, req.Values); err != nil {
-		os.RemoveAll(outputDir)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := templates.ComputeFields(manifest, req.Values); err != nil {
+		genErr = err
+		s.metrics.renderFailures.WithLabelValues(req.TemplateName).Inc()
+		s.fail(c, ev, http.StatusUnprocessableEntity, err.Error())
 		return
 	}
 
-	// 创建 zip 文件
+	// 直接渲染到 zip 文件，客户端断开时取消渲染
 	zipPath := filepath.Join(os.TempDir(), fmt.Sprintf("kuai-project-%d.zip", time.Now().UnixNano()))
-	if err := createZip(outputDir, zipPath); err != nil {
-		os.RemoveAll(outputDir)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := s.renderZip(c.Request.Context(), resolved, req.Values, zipPath); err != nil {
+		genErr = err
+		s.metrics.renderFailures.WithLabelValues(req.TemplateName).Inc()
+		ev.Error = err.Error()
+		c.JSON(renderErrorResponse(err))
 		return
 	}
 
 	// 保存 zip 文件路径到临时存储
 	zipID := filepath.Base(zipPath)
-	
+	s.downloads.Store(zipID, req.TemplateName)
+	ev.Detail = zipID
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":      "success",
 		"downloadId":  zipID,
-		"downloadUrl": "/api/download/" + zipID,
+		"downloadUrl": s.opts.BasePath + "/api/download/" + zipID,
 	})
 }
 
+// handleHistory 查询审计日志，支持 template、action、user、since（RFC3339）和 limit 参数。
+func (s *Server) handleHistory(c *gin.Context) {
+	filter := audit.Filter{
+		Template: c.Query("template"),
+		Action:   c.Query("action"),
+		User:     c.Query("user"),
+		Limit:    100,
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 必须是非负整数"})
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := c.Query("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since 必须是 RFC3339 时间"})
+			return
+		}
+		filter.Since = since
+	}
+
+	events, err := audit.Query(s.audit.Path(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// previewFile 是预览接口返回的单个文件。
+type previewFile struct {
+	Path     string `json:"path"`
+	Content  string `json:"content,omitempty"`
+	Language string `json:"language"`
+	Size     int    `json:"size"`
+	Binary   bool   `json:"binary,omitempty"`
+	Mode     string `json:"mode"`           // 文件权限，如 0755
+	Link     string `json:"link,omitempty"` // 符号链接的目标
+}
+
+// handlePreview 在内存中渲染模板，返回单个或全部文件的内容，不落盘。
+func (s *Server) handlePreview(c *gin.Context) {
+	var req struct {
+		Values map[string]any `json:"values"`
+		File   string         `json:"file"`   // 渲染后的相对路径，为空时返回全部文件
+		Target string         `json:"target"` // 项目名，用作 TargetDir/TargetBase，默认使用模板名
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	templateName := c.Param("name")
+	resolved, status, err := s.resolveTemplate(templateName)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	manifest := resolved.Manifest
+
+	if req.Values == nil {
+		req.Values = map[string]any{}
+	}
+	templates.MergeBuiltins(manifest, req.Values, s.builtinValues(templateName, req.Target))
+	if err := templates.ApplyDefaults(manifest, req.Values); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	if err := templates.ComputeFields(manifest, req.Values); err != nil {
+		s.metrics.renderFailures.WithLabelValues(templateName).Inc()
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	sink := &templates.MemorySink{}
+	if err := s.renderer(resolved).Render(c.Request.Context(), req.Values, sink); err != nil {
+		s.metrics.renderFailures.WithLabelValues(templateName).Inc()
+		c.JSON(renderErrorResponse(err))
+		return
+	}
+
+	files := make([]previewFile, 0, len(sink.Files))
+	for _, f := range sink.Files {
+		if req.File != "" && f.Path != req.File {
+			continue
+		}
+		pf := previewFile{
+			Path:     f.Path,
+			Language: languageFor(f.Path),
+			Size:     len(f.Content),
+			Mode:     fmt.Sprintf("%04o", f.Mode.Perm()),
+			Link:     f.Link,
+		}
+		if f.Link != "" {
+			pf.Content = "-> " + f.Link
+		} else if bytes.IndexByte(f.Content, 0) >= 0 {
+			pf.Binary = true
+		} else {
+			pf.Content = string(f.Content)
+		}
+		files = append(files, pf)
+	}
+	if req.File != "" && len(files) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("文件 %s 不存在", req.File)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+// handleDefaults 基于已填写的变量计算各字段的建议默认值，前端用它刷新用户未修改过的输入框。
+func (s *Server) handleDefaults(c *gin.Context) {
+	var req struct {
+		Values map[string]any `json:"values"` // 用户已修改过的字段
+		Target string         `json:"target"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := templates.ValidateValueNames(req.Values); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	templateName := c.Param("name")
+	resolved, status, err := s.resolveTemplate(templateName)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	manifest := resolved.Manifest
+
+	if req.Values == nil {
+		req.Values = map[string]any{}
+	}
+	templates.MergeBuiltins(manifest, req.Values, s.builtinValues(templateName, req.Target))
+	c.JSON(http.StatusOK, gin.H{"defaults": templates.ResolveDefaults(manifest, req.Values)})
+}
+
 func (s *Server) handleDownload(c *gin.Context) {
 	zipID := c.Param("id")
 	zipPath := filepath.Join(os.TempDir(), zipID)
 
+	ev := &audit.Event{Action: audit.ActionDownload, Detail: zipID}
+	if name, ok := s.downloads.Load(zipID); ok {
+		ev.Template = name.(string)
+	}
+	defer s.record(c, ev)
+
 	// 检查文件是否存在
 	if _, err := os.Stat(zipPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		s.fail(c, ev, http.StatusNotFound, "File not found")
 		return
 	}
 
@@ -248,76 +480,268 @@ func (s *Server) handleDownload(c *gin.Context) {
 	c.File(zipPath)
 }
 
-// extractZip 解压 zip 文件
-func extractZip(zipPath, destDir string) error {
-	r, err := zip.OpenReader(zipPath)
-	if err != nil {
-		return err
+// limitBody 限制请求体大小，超出后读取请求体会返回 *http.MaxBytesError。
+func (s *Server) limitBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.opts.MaxUploadSize > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.opts.MaxUploadSize)
+		}
+		c.Next()
 	}
-	defer r.Close()
+}
 
-	for _, f := range r.File {
-		fpath := filepath.Join(destDir, f.Name)
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, f.FileInfo().Mode())
-			continue
+// normalizeBasePath 将路径前缀规范为以 / 开头、不以 / 结尾的形式，根路径返回空字符串。
+func normalizeBasePath(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// fail 返回错误响应，并把错误信息记入审计事件。
+func (s *Server) fail(c *gin.Context, ev *audit.Event, status int, msg string) {
+	ev.Error = msg
+	c.JSON(status, gin.H{"error": msg})
+}
+
+// record 补全请求方信息后写入审计日志，结果由响应状态码决定；必须直接以 defer s.record(c, ev) 调用。
+// 处理函数 panic 时 Recovery 尚未写入 500，状态码仍是 200，因此先 recover 记为失败，再继续 panic 交给 Recovery；
+// 没有写入任何响应的请求同样记为失败。
+func (s *Server) record(c *gin.Context, ev *audit.Event) {
+	recovered := recover()
+	ev.User = s.requestUser(c)
+	ev.ClientIP = c.ClientIP()
+	ev.Outcome = audit.OutcomeSuccess
+	switch {
+	case recovered != nil:
+		ev.Outcome = audit.OutcomeFailure
+		if ev.Error == "" {
+			ev.Error = fmt.Sprintf("内部错误: %v", recovered)
 		}
-		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
-			return err
+	case !c.Writer.Written() || c.Writer.Status() >= http.StatusBadRequest:
+		ev.Outcome = audit.OutcomeFailure
+	}
+	if err := s.audit.Record(*ev); err != nil {
+		fmt.Printf("Warning: Failed to write audit log: %v\n", err)
+	}
+	if recovered != nil {
+		panic(recovered)
+	}
+}
+
+// requestUser 识别请求用户：请求直接来自可信代理时使用代理注入的身份头，其次是 Basic Auth 用户名。
+// 身份头可以由任何客户端伪造，因此不是来自 TrustedProxies 的请求会忽略这些头。
+func (s *Server) requestUser(c *gin.Context) string {
+	if s.fromTrustedProxy(c) {
+		for _, header := range []string{"X-Forwarded-User", "X-Remote-User", "X-Auth-Request-User"} {
+			if user := c.GetHeader(header); user != "" {
+				return user
+			}
 		}
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.FileInfo().Mode())
-		if err != nil {
-			return err
+	}
+	if user, _, ok := c.Request.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// fromTrustedProxy 判断请求的直接来源（TCP 对端）是否是可信代理。
+func (s *Server) fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.trustedNets {
+		if network.Contains(ip) {
+			return true
 		}
-		rc, err := f.Open()
-		if err != nil {
-			outFile.Close()
-			return err
+	}
+	return false
+}
+
+// parseTrustedProxies 将 IP 或 CIDR 列表解析为网段，单个 IP 视为只包含该地址的网段。
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP %q", p)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
 		}
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
-		rc.Close()
+		_, network, err := net.ParseCIDR(p)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// templateVersion 返回模板 manifest 中的版本号，读取失败时返回空字符串。
+func (s *Server) templateVersion(name string) string {
+	templatePath, err := s.templateMgr.TemplatePath(name)
+	if err != nil {
+		return ""
+	}
+	manifest, _, err := templates.LoadManifest(templatePath)
+	if err != nil || manifest == nil {
+		return ""
+	}
+	return manifest.Meta.Version
+}
+
+// withoutBuiltins 去掉未被覆盖的内置变量，避免审计日志记录服务端环境信息。
+func withoutBuiltins(values map[string]any, builtins map[string]string) map[string]any {
+	result := make(map[string]any, len(values))
+	for k, v := range values {
+		if b, ok := builtins[k]; ok && b == v {
+			continue
 		}
+		result[k] = v
 	}
-	return nil
+	return result
+}
+
+// serverBuiltins 计算 Web 生成时不随请求变化的内置变量。
+// 服务端的 git 配置属于运维人员而不是请求用户，GitUserName 和 GitUserEmail 始终为空。
+func serverBuiltins() map[string]string {
+	builtins := templates.Builtins("", "")
+	builtins["GitUserName"] = ""
+	builtins["GitUserEmail"] = ""
+	return builtins
 }
 
-// createZip 创建 zip 文件
-func createZip(sourceDir, zipPath string) error {
+// builtinValues 计算 Web 生成时的内置变量，在启动时计算的结果上刷新模板名、日期和目标目录。
+// 服务端没有真实的目标目录，TargetDir 和 TargetBase 都使用项目名。
+func (s *Server) builtinValues(templateName, target string) map[string]string {
+	target = filepath.Base(strings.TrimSpace(target))
+	if target == "" || target == "." || target == string(filepath.Separator) {
+		target = templateName
+	}
+	now := time.Now()
+	builtins := make(map[string]string, len(s.builtins))
+	for k, v := range s.builtins {
+		builtins[k] = v
+	}
+	builtins["TemplateName"] = templateName
+	builtins["Year"] = now.Format("2006")
+	builtins["Date"] = now.Format("2006-01-02")
+	builtins["TargetDir"] = target
+	builtins["TargetBase"] = target
+	return builtins
+}
+
+// resolveTemplate 展开模板的 extends/include，返回出错时应使用的 HTTP 状态码。
+func (s *Server) resolveTemplate(name string) (*templates.ResolvedTemplate, int, error) {
+	if _, err := s.templateMgr.TemplatePath(name); err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	resolved, err := s.templateMgr.Resolve(name)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return resolved, http.StatusOK, nil
+}
+
+// renderer 返回合成模板的渲染器，并加入共享 partial 目录。
+func (s *Server) renderer(resolved *templates.ResolvedTemplate) *templates.Renderer {
+	opts := resolved.RenderOptions()
+	opts.PartialDirs = append([]string{s.paths.PartialsDir}, opts.PartialDirs...)
+	// 服务端不运行模板中的外部格式化命令（AllowExternalFormatters 保持 false）
+	// 一次返回所有文件的渲染错误，便于在页面中逐个定位
+	opts.CollectErrors = true
+	return &templates.Renderer{Source: templates.DirFS(resolved.SourceDir()), Options: opts}
+}
+
+// renderZip 将模板渲染为 zip 文件，失败时删除不完整的文件。
+func (s *Server) renderZip(ctx context.Context, resolved *templates.ResolvedTemplate, values map[string]any, zipPath string) error {
 	file, err := os.Create(zipPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	sink := templates.NewZipSink(file)
+	err = s.renderer(resolved).Render(ctx, values, sink)
+	if err == nil {
+		err = sink.Close()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(zipPath)
+	}
+	return err
+}
 
-	w := zip.NewWriter(file)
-	defer w.Close()
+// renderErrorResponse 返回渲染失败的状态码和响应：模板错误为 422，附带逐个文件的 renderErrors；其他错误为 500。
+func renderErrorResponse(err error) (int, gin.H) {
+	if renderErrs := templates.AsRenderErrors(err); renderErrs != nil {
+		return http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "renderErrors": renderErrs}
+	}
+	return http.StatusInternalServerError, gin.H{"error": err.Error()}
+}
 
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		relPath, err := filepath.Rel(sourceDir, path)
-		if err != nil {
-			return err
-		}
-		f, err := w.Create(relPath)
-		if err != nil {
-			return err
-		}
-		srcFile, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer srcFile.Close()
-		_, err = io.Copy(f, srcFile)
-		return err
-	})
+// languageFor 根据文件名推断语法高亮语言，供前端展示。
+func languageFor(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	switch {
+	case base == "dockerfile" || strings.HasPrefix(base, "dockerfile."):
+		return "dockerfile"
+	case base == "makefile":
+		return "makefile"
+	case base == "go.mod" || base == "go.sum":
+		return "go-module"
+	}
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".go":
+		return "go"
+	case ".js", ".mjs", ".cjs":
+		return "javascript"
+	case ".ts", ".tsx":
+		return "typescript"
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".md":
+		return "markdown"
+	case ".sh", ".bash":
+		return "shell"
+	case ".py":
+		return "python"
+	case ".proto":
+		return "protobuf"
+	case ".sql":
+		return "sql"
+	case ".html", ".htm":
+		return "html"
+	case ".css":
+		return "css"
+	case ".xml":
+		return "xml"
+	default:
+		return "plaintext"
+	}
+}
+
+// respondValidationError 返回变量校验错误，附带逐字段信息供前端高亮。
+func respondValidationError(c *gin.Context, err error) {
+	var verr *templates.ValidationError
+	if errors.As(err, &verr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error(), "fieldErrors": verr.Fields})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 }
 
 // saveTemplateDescription 保存模板描述到 manifest 文件
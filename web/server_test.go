@@ -0,0 +1,99 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jundy/kuai/pkg/audit"
+	"github.com/jundy/kuai/pkg/config"
+	"github.com/jundy/kuai/pkg/templates"
+)
+
+// newTestServer 创建使用临时目录的 Server。
+func newTestServer(t *testing.T, opts Options) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	paths := config.Paths{
+		ConfigDir:    dir,
+		DataDir:      dir,
+		TemplatesDir: filepath.Join(dir, "templates"),
+		HistoryFile:  filepath.Join(dir, "history.jsonl"),
+	}
+	s, err := NewServer(templates.NewManager(paths), paths, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRequestUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		remote  string
+		headers map[string]string
+		basic   string
+		want    string
+	}{
+		{name: "未配置可信代理时忽略身份头", remote: "10.0.0.5:1234", headers: map[string]string{"X-Forwarded-User": "mallory"}, want: "anonymous"},
+		{name: "未配置可信代理时使用 Basic Auth", remote: "10.0.0.5:1234", headers: map[string]string{"X-Forwarded-User": "mallory"}, basic: "bob", want: "bob"},
+		{name: "不可信来源伪造身份头", trusted: []string{"10.0.0.0/8"}, remote: "192.168.1.9:1234", headers: map[string]string{"X-Forwarded-User": "mallory", "X-Remote-User": "mallory", "X-Auth-Request-User": "mallory"}, want: "anonymous"},
+		{name: "伪造 X-Forwarded-For 冒充可信代理", trusted: []string{"10.0.0.1"}, remote: "192.168.1.9:1234", headers: map[string]string{"X-Forwarded-For": "10.0.0.1", "X-Forwarded-User": "mallory"}, basic: "bob", want: "bob"},
+		{name: "可信网段", trusted: []string{"10.0.0.0/8"}, remote: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-User": "alice"}, basic: "bob", want: "alice"},
+		{name: "可信 IP 的其他身份头", trusted: []string{"127.0.0.1"}, remote: "127.0.0.1:1234", headers: map[string]string{"X-Auth-Request-User": "carol"}, want: "carol"},
+		{name: "可信 IPv6", trusted: []string{"::1"}, remote: "[::1]:1234", headers: map[string]string{"X-Remote-User": "dave"}, want: "dave"},
+		{name: "可信代理未提供身份头", trusted: []string{"127.0.0.1"}, remote: "127.0.0.1:1234", want: "anonymous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, Options{TrustedProxies: tt.trusted})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.basic != "" {
+				req.SetBasicAuth(tt.basic, "secret")
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+			if got := s.requestUser(c); got != tt.want {
+				t.Fatalf("用户为 %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	for _, p := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := parseTrustedProxies([]string{p}); err == nil {
+			t.Errorf("%q 应该解析失败", p)
+		}
+	}
+}
+
+// TestRecordPanicIsFailure 确认处理函数 panic 时审计事件记为失败，而不是 Recovery 写入 500 之前的 200。
+func TestRecordPanicIsFailure(t *testing.T) {
+	s := newTestServer(t, Options{})
+	s.engine.POST("/panic", func(c *gin.Context) {
+		ev := &audit.Event{Action: audit.ActionGenerate, Template: "demo"}
+		defer s.record(c, ev)
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("状态码为 %d，期望 500", w.Code)
+	}
+	events, err := audit.Query(s.paths.HistoryFile, audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Outcome != audit.OutcomeFailure || events[0].Error == "" {
+		t.Fatalf("审计事件为 %+v，期望一条带错误信息的失败记录", events)
+	}
+}
@@ -2,6 +2,14 @@ let currentTemplate = null;
 let modal = null;
 let allTemplates = []; // 存储所有模板用于搜索过滤
 
+// 部署在反向代理的路径前缀下时由服务端注入，如 /kuai
+const BASE_PATH = document.querySelector('meta[name="kuai-base-path"]')?.content || '';
+
+// 拼接带路径前缀的 API 地址
+function apiUrl(path) {
+    return BASE_PATH + path;
+}
+
 // Tab switching
 document.querySelectorAll('.nav-tab').forEach(tab => {
     tab.addEventListener('click', (e) => {
@@ -62,7 +70,7 @@ async function loadTemplates() {
     `;
     
     try {
-        const res = await fetch('/api/templates');
+        const res = await fetch(apiUrl('/api/templates'));
         if (!res.ok) throw new Error('Failed to load templates');
         
         const templates = await res.json();
@@ -83,6 +91,68 @@ async function loadTemplates() {
     }
 }
 
+// 输入框占位提示：计算字段显示表达式，留空时自动计算
+function fieldPlaceholder(field) {
+    if (field.value) return '自动计算: ' + escapeHtml(field.value);
+    if (field.type === 'list') return '多个值用逗号分隔，如 redis, mysql';
+    if (field.type === 'object') return escapeHtml('JSON 对象，如 {"host": "localhost"}');
+    return field.default ? '默认: ' + escapeHtml(field.default) : '';
+}
+
+// 默认值是否为引用其他变量的表达式
+function isExpression(value) {
+    return !!value && value.includes('{{');
+}
+
+// 默认值表达式：记录用户修改过的字段，其余字段的建议默认值随输入重新计算
+const dynamicDefaults = {
+    template: null,
+    touched: new Set(),
+    timer: null,
+};
+
+function setupDynamicDefaults(templateName, fields) {
+    dynamicDefaults.template = templateName;
+    dynamicDefaults.touched = new Set();
+    clearTimeout(dynamicDefaults.timer);
+    if (!fields.some(field => isExpression(field.default))) return;
+
+    document.querySelectorAll('#form-fields input').forEach(input => {
+        input.addEventListener('input', () => {
+            dynamicDefaults.touched.add(input.name);
+            clearTimeout(dynamicDefaults.timer);
+            dynamicDefaults.timer = setTimeout(refreshDefaults, 300);
+        });
+    });
+    refreshDefaults();
+}
+
+async function refreshDefaults() {
+    const templateName = dynamicDefaults.template;
+    const inputs = document.querySelectorAll('#form-fields input');
+    const values = {};
+    inputs.forEach(input => {
+        if (dynamicDefaults.touched.has(input.name)) values[input.name] = input.value;
+    });
+
+    try {
+        const res = await fetch(apiUrl(`/api/templates/${encodeURIComponent(templateName)}/defaults`), {
+            method: 'POST',
+            headers: {'Content-Type': 'application/json'},
+            body: JSON.stringify({ values })
+        });
+        if (!res.ok || templateName !== dynamicDefaults.template) return;
+        const { defaults } = await res.json();
+        inputs.forEach(input => {
+            if (!dynamicDefaults.touched.has(input.name) && defaults[input.name] !== undefined) {
+                input.value = defaults[input.name];
+            }
+        });
+    } catch (error) {
+        // 建议默认值刷新失败不影响表单提交，服务端仍会计算默认值
+    }
+}
+
 // Open generate modal
 async function openGenerateModal(templateName) {
     currentTemplate = templateName;
@@ -92,7 +162,7 @@ async function openGenerateModal(templateName) {
     messageDiv.innerHTML = '';
     
     try {
-        const res = await fetch(`/api/templates/${encodeURIComponent(templateName)}`);
+        const res = await fetch(apiUrl(`/api/templates/${encodeURIComponent(templateName)}`));
         if (!res.ok) throw new Error('Failed to load template details');
         
         const manifest = await res.json();
@@ -107,19 +177,20 @@ async function openGenerateModal(templateName) {
                     <label class="form-label">
                         ${escapeHtml(field.prompt || field.name)}
                         ${field.description ? `<span style="color: var(--text-secondary); font-weight: normal;">(${escapeHtml(field.description)})</span>` : ''}
-                        ${field.required ? '<span style="color: var(--error);">*</span>' : ''}
+                        ${field.required && !field.value ? '<span style="color: var(--error);">*</span>' : ''}
                     </label>
                     <input 
                         type="text" 
                         name="${escapeHtml(field.name)}" 
                         class="form-input"
-                        value="${escapeHtml(field.default || '')}"
-                        ${field.required ? 'required' : ''}
-                        placeholder="${field.default ? '默认: ' + escapeHtml(field.default) : ''}"
+                        value="${field.value || isExpression(field.default) ? '' : escapeHtml(field.default || '')}"
+                        ${field.required && !field.value ? 'required' : ''}
+                        placeholder="${fieldPlaceholder(field)}"
                     >
                 `;
                 formFields.appendChild(div);
             });
+            setupDynamicDefaults(templateName, manifest.fields);
         } else {
             formFields.innerHTML = '<p style="color: var(--text-secondary);">此模板无需配置参数</p>';
         }
@@ -152,10 +223,11 @@ async function submitGenerate() {
     // 显示加载状态
     submitBtn.classList.add('loading');
     submitBtn.disabled = true;
+    clearFieldErrors(form);
     messageDiv.innerHTML = '<div class="alert alert-info">正在生成项目...</div>';
     
     try {
-        const res = await fetch('/api/generate', {
+        const res = await fetch(apiUrl('/api/generate'), {
             method: 'POST',
             headers: {'Content-Type': 'application/json'},
             body: JSON.stringify({
@@ -174,7 +246,12 @@ async function submitGenerate() {
                 messageDiv.innerHTML = '';
             }, 2000);
         } else {
-            messageDiv.innerHTML = `<div class="alert alert-error">生成失败: ${escapeHtml(result.error || '未知错误')}</div>`;
+            if (result.fieldErrors && result.fieldErrors.length > 0) {
+                showFieldErrors(form, result.fieldErrors);
+            }
+            messageDiv.innerHTML = result.renderErrors
+                ? renderErrorsHtml('生成失败', result.renderErrors)
+                : `<div class="alert alert-error">生成失败: ${escapeHtml(result.error || '未知错误')}</div>`;
             submitBtn.classList.remove('loading');
             submitBtn.disabled = false;
         }
@@ -185,6 +262,41 @@ async function submitGenerate() {
     }
 }
 
+// 高亮服务端返回的字段错误
+function showFieldErrors(form, fieldErrors) {
+    fieldErrors.forEach(fe => {
+        const input = form.querySelector(`[name="${CSS.escape(fe.field)}"]`);
+        if (!input) return;
+        input.classList.add('input-error');
+        const hint = document.createElement('div');
+        hint.className = 'field-error';
+        hint.textContent = fe.message;
+        input.insertAdjacentElement('afterend', hint);
+    });
+    const first = form.querySelector('.input-error');
+    if (first) first.focus();
+}
+
+// 渲染错误列表：每个错误显示位置、目标路径、出错的变量和源文件片段
+function renderErrorsHtml(title, renderErrors) {
+    const items = renderErrors.map(e => {
+        let location = e.file;
+        const pos = e.line ? `:${e.line}${e.col ? ':' + e.col : ''}` : '';
+        location += e.partial ? ` (partial ${e.partial}${pos})` : pos;
+        const target = e.path && e.path !== e.file ? ` → ${e.path}` : '';
+        const variable = e.variable ? `变量 ${e.variable}: ` : '';
+        const snippet = e.snippet ? `<pre>${escapeHtml(e.snippet)}</pre>` : '';
+        return `<li><code>${escapeHtml(location + target)}</code><div>${escapeHtml(variable + e.message)}</div>${snippet}</li>`;
+    }).join('');
+    return `<div class="alert alert-error">${escapeHtml(title)}: ${renderErrors.length} 个渲染错误<ul class="render-errors">${items}</ul></div>`;
+}
+
+// 清除字段错误标记
+function clearFieldErrors(form) {
+    form.querySelectorAll('.input-error').forEach(el => el.classList.remove('input-error'));
+    form.querySelectorAll('.field-error').forEach(el => el.remove());
+}
+
 // Upload form
 document.getElementById('upload-form').addEventListener('submit', async (e) => {
     e.preventDefault();
@@ -208,7 +320,7 @@ document.getElementById('upload-form').addEventListener('submit', async (e) => {
     messageDiv.innerHTML = '<div class="alert alert-info">正在上传...</div>';
     
     try {
-        const res = await fetch('/api/upload', {
+        const res = await fetch(apiUrl('/api/upload'), {
             method: 'POST',
             body: formData
         });
@@ -379,7 +491,7 @@ async function openPreviewModal(templateName) {
     content.innerHTML = '<div class="loading">加载中...</div>';
     
     try {
-        const res = await fetch(`/api/templates/${encodeURIComponent(templateName)}`);
+        const res = await fetch(apiUrl(`/api/templates/${encodeURIComponent(templateName)}`));
         if (!res.ok) throw new Error('Failed to load template details');
         
         const manifest = await res.json();
@@ -412,6 +524,7 @@ async function openPreviewModal(templateName) {
                         </div>
                         ${field.description ? `<div class="preview-field-desc">${escapeHtml(field.description)}</div>` : ''}
                         ${field.default ? `<div class="preview-field-default">默认值: <code>${escapeHtml(field.default)}</code></div>` : ''}
+                        ${field.value ? `<div class="preview-field-default">计算: <code>${escapeHtml(field.value)}</code></div>` : ''}
                     </div>
                 `;
             });
@@ -428,8 +541,25 @@ async function openPreviewModal(templateName) {
             `;
         }
         
+        html += `
+                <div class="preview-item">
+                    <strong>文件预览：</strong>
+                    <div class="live-preview">
+                        <div id="live-preview-fields" class="live-preview-fields"></div>
+                        <div class="live-preview-body">
+                            <div id="live-preview-tree" class="file-tree"></div>
+                            <div class="file-viewer">
+                                <div id="live-preview-path" class="file-viewer-header"></div>
+                                <pre><code id="live-preview-code"></code></pre>
+                            </div>
+                        </div>
+                        <div id="live-preview-message"></div>
+                    </div>
+                </div>
+        `;
         html += '</div>';
         content.innerHTML = html;
+        setupLivePreview(templateName, manifest.fields || []);
         
         // 设置使用按钮
         document.getElementById('preview-use-btn').onclick = () => {
@@ -446,6 +576,147 @@ async function openPreviewModal(templateName) {
 // Close preview modal
 function closePreviewModal() {
     document.getElementById('preview-modal').classList.remove('active');
+    clearTimeout(livePreview.timer);
+    livePreview.template = null;
+}
+
+// 实时文件预览状态
+const livePreview = {
+    template: null,
+    files: [],
+    selected: null,
+    timer: null,
+    seq: 0,
+};
+
+// 初始化实时预览：生成变量输入框并渲染一次
+function setupLivePreview(templateName, fields) {
+    livePreview.template = templateName;
+    livePreview.files = [];
+    livePreview.selected = null;
+
+    const container = document.getElementById('live-preview-fields');
+    container.innerHTML = '';
+    fields.forEach(field => {
+        const input = document.createElement('input');
+        input.type = 'text';
+        input.name = field.name;
+        input.className = 'form-input';
+        input.value = field.value || isExpression(field.default) ? '' : (field.default || '');
+        input.placeholder = field.value ? `${field.name}: ${field.value}` : (field.prompt || field.name);
+        input.title = field.prompt || field.name;
+        input.addEventListener('input', scheduleLivePreview);
+        container.appendChild(input);
+    });
+
+    refreshLivePreview();
+}
+
+// 输入变化后延迟刷新，避免频繁请求
+function scheduleLivePreview() {
+    clearTimeout(livePreview.timer);
+    livePreview.timer = setTimeout(refreshLivePreview, 300);
+}
+
+async function refreshLivePreview() {
+    const templateName = livePreview.template;
+    if (!templateName) return;
+
+    const values = {};
+    document.querySelectorAll('#live-preview-fields input').forEach(input => {
+        values[input.name] = input.value;
+    });
+
+    const seq = ++livePreview.seq;
+    const messageDiv = document.getElementById('live-preview-message');
+    try {
+        const res = await fetch(apiUrl(`/api/templates/${encodeURIComponent(templateName)}/preview`), {
+            method: 'POST',
+            headers: {'Content-Type': 'application/json'},
+            body: JSON.stringify({ values: values })
+        });
+        const result = await res.json();
+        // 忽略过期的响应
+        if (seq !== livePreview.seq) return;
+        if (!res.ok) {
+            messageDiv.innerHTML = result.renderErrors
+                ? renderErrorsHtml('预览失败', result.renderErrors)
+                : `<div class="alert alert-error">预览失败: ${escapeHtml(result.error || '未知错误')}</div>`;
+            return;
+        }
+        messageDiv.innerHTML = '';
+        livePreview.files = result.files || [];
+        if (!livePreview.files.some(f => f.path === livePreview.selected)) {
+            livePreview.selected = livePreview.files.length > 0 ? livePreview.files[0].path : null;
+        }
+        renderFileTree();
+        showPreviewFile(livePreview.selected);
+    } catch (error) {
+        messageDiv.innerHTML = `<div class="alert alert-error">预览失败: ${escapeHtml(error.message)}</div>`;
+    }
+}
+
+// 将文件路径列表渲染为目录树
+function renderFileTree() {
+    const root = {};
+    livePreview.files.forEach(file => {
+        let node = root;
+        const parts = file.path.split('/');
+        parts.forEach((part, i) => {
+            if (i === parts.length - 1) {
+                node[part] = file.path;
+            } else {
+                node[part] = node[part] || {};
+                node = node[part];
+            }
+        });
+    });
+
+    const build = (node) => {
+        const names = Object.keys(node).sort((a, b) => {
+            const aDir = typeof node[a] === 'object';
+            const bDir = typeof node[b] === 'object';
+            if (aDir !== bDir) return aDir ? -1 : 1;
+            return a.localeCompare(b);
+        });
+        let html = '<ul>';
+        names.forEach(name => {
+            const child = node[name];
+            if (typeof child === 'object') {
+                html += `<li class="tree-dir"><span>📁 ${escapeHtml(name)}</span>${build(child)}</li>`;
+            } else {
+                const active = child === livePreview.selected ? ' active' : '';
+                html += `<li class="tree-file${active}" data-path="${escapeHtml(child)}">📄 ${escapeHtml(name)}</li>`;
+            }
+        });
+        return html + '</ul>';
+    };
+
+    const tree = document.getElementById('live-preview-tree');
+    tree.innerHTML = livePreview.files.length > 0 ? build(root) : '<p class="empty-hint">无文件</p>';
+    tree.querySelectorAll('.tree-file').forEach(el => {
+        el.addEventListener('click', () => {
+            livePreview.selected = el.dataset.path;
+            tree.querySelectorAll('.tree-file').forEach(f => f.classList.remove('active'));
+            el.classList.add('active');
+            showPreviewFile(livePreview.selected);
+        });
+    });
+}
+
+function showPreviewFile(path) {
+    const file = livePreview.files.find(f => f.path === path);
+    const header = document.getElementById('live-preview-path');
+    const code = document.getElementById('live-preview-code');
+    if (!file) {
+        header.textContent = '';
+        code.textContent = '';
+        code.className = '';
+        return;
+    }
+    header.textContent = `${file.path} · ${file.language} · ${file.size} bytes`;
+    code.className = `language-${file.language}`;
+    code.textContent = file.binary ? '(二进制文件，无法预览)' : file.content;
 }
 
 // Escape HTML